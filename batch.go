@@ -1,277 +1,1295 @@
 package s3box
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// TODO modify print of result and error
+const (
+	// maxCleanErrors limits the number of per-key errors kept in a CleanResult
+	maxCleanErrors = 10000
+	// maxDeleteObjects is the most versions DeleteObjects accepts in a request
+	maxDeleteObjects   = 1000
+	defaultBatchLinger = 100 * time.Millisecond
+
+	defaultRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// JobOptions are the listing, throttling and reporting settings shared by BucketCleaner and BulkJob
+type JobOptions struct {
+	// Progress receives the snapshots of running tasks, StdoutProgressReporter is used by default
+	Progress ProgressReporter
+	// ProgressInterval is the interval between two snapshots, one second by default
+	ProgressInterval time.Duration
+	// Filter selects the object versions to be processed, all versions are processed when it is nil.
+	// Multipart uploads are aborted only if their key and initiated time match,
+	// and none of them is aborted when NoncurrentOnly, DeleteMarkersOnly, Tags, MinSize or MaxSize is set.
+	Filter *ObjectFilter
+	// DryRun makes the job do the full listing without changing anything,
+	// the bucket is never deleted in this mode
+	DryRun bool
+	// Manifest records every version, delete marker and multipart upload to be processed if it is set.
+	// A manifest written in dry-run mode can be used as the input of EmptyBucketFromManifest later.
+	Manifest *ManifestWriter
+	// CheckpointFile is the local file to save the listing position and counts of unfinished runs,
+	// a run resumes from it on restart and removes its position once it completes.
+	// The versions failed in a run are saved with the position and retried by the next run, at most
+	// maxCleanErrors of them. A checkpoint file should not be shared by different kinds of jobs.
+	CheckpointFile string
+	// CheckpointInterval is the interval between two saves, 10 seconds by default
+	CheckpointInterval time.Duration
+	// ListPrefixes splits the listing into a lister per prefix, only the versions and multipart uploads
+	// under them are processed. The prefixes should not overlap each other.
+	ListPrefixes []string
+	// ListDelimiter splits the listing by the common prefixes found with the delimiter under Filter.Prefix,
+	// the keys without the delimiter are listed by a lister of their own. It is ignored if ListPrefixes is set.
+	ListDelimiter string
+	// ListWorkerNum is the number of listers running concurrently, 1 by default
+	ListWorkerNum int
+	// RequestsPerSecond caps the delete, abort, update and copy requests sent per second, 0 means unlimited
+	RequestsPerSecond float64
+	// ObjectsPerSecond caps the versions processed per second, 0 means unlimited
+	ObjectsPerSecond float64
+	// AdaptiveRate halves the rates when the requests are throttled and raises them slowly on success,
+	// the rates are learned from the observed ones if they are unlimited
+	AdaptiveRate bool
+	// MaxRetries is the number of retries of a version failed with a throttling or server error, 3 by default
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, it is doubled every retry. 500ms by default
+	RetryBackoff time.Duration
+}
+
 type BucketCleaner struct {
-	svc          *s3.S3
-	deletedCount uint64
+	svc *s3.S3
+
+	JobOptions
+
+	// BypassGovernanceRetention deletes versions under GOVERNANCE retention,
+	// which requires the s3:BypassGovernanceRetention permission
+	BypassGovernanceRetention bool
+	// RemoveLegalHolds removes the legal hold of a version which failed to be deleted
+	// on a bucket with Object Lock, and then deletes it again
+	RemoveLegalHolds bool
+	// BatchLinger is the longest time to wait for a batch of DeleteObjects to be full, 100ms by default.
+	// With a zero linger, the versions ready in the channel are deleted without waiting.
+	BatchLinger time.Duration
+
+	// reqLimiter and objLimiter are shared by all the tasks if they are set, such as the budgets of a FleetCleaner.
+	// Otherwise every task has limiters of its own.
+	reqLimiter *RateLimiter
+	objLimiter *RateLimiter
+
+	ckptMu    sync.Mutex
+	ckptStore *checkpointStore
+}
+
+// CleanResult tells how far an EmptyBucket run got, it is partial when the run is canceled
+type CleanResult struct {
+	Bucket string
+	Listed uint64
+	// Skipped is the number of versions excluded by the filter
+	Skipped uint64
+	// Bytes is the total size of listed versions and multipart uploads
+	Bytes   uint64
+	Deleted uint64
+	Failed  uint64
+	Aborted uint64
+	// ObjectLockEnabled is true if Object Lock is enabled on the bucket
+	ObjectLockEnabled bool
+	// Errors holds the per-key errors of deleting objects and aborting multipart uploads,
+	// at most maxCleanErrors of them are kept while Failed always counts all the failures
+	Errors  []ObjectError
+	Elapsed time.Duration
+	// Completed is true only when the whole bucket has been walked without being canceled
+	Completed bool
+}
+
+// ObjectError is the failure of deleting an object version or aborting a multipart upload
+type ObjectError struct {
+	Key       string
+	VersionId string
+	UploadId  string
+	Code      string
+	Message   string
+	// Lock is the retention or legal hold blocking the deletion, it is set only on buckets with Object Lock
+	Lock *ObjectLockInfo
+}
+
+func (e *ObjectError) Error() string {
+	if e.UploadId != "" {
+		return fmt.Sprintf("%s (UploadId: %s): %s: %s", e.Key, e.UploadId, e.Code, e.Message)
+	}
+	if e.Lock != nil {
+		return fmt.Sprintf("%s (VersionId: %s): %s: %s, %s", e.Key, e.VersionId, e.Code, e.Message, e.Lock)
+	}
+	return fmt.Sprintf("%s (VersionId: %s): %s: %s", e.Key, e.VersionId, e.Code, e.Message)
+}
+
+// cleanSource provides the versions and multipart uploads to be removed by a task
+type cleanSource struct {
+	listObjs        func(*cleanTask, chan<- cleanObj)
+	abortMultiparts func(*cleanTask)
+	// resumable is true if the listing position can be saved in a checkpoint
+	resumable bool
+}
+
+// listShard is a part of the keyspace listed by a lister
+type listShard struct {
+	prefix string
+	// delimiter is set only for the shard of keys without the delimiter
+	delimiter string
+}
+
+// key identifies the shard in the checkpoint
+func (s listShard) key() string {
+	if s.delimiter == "" {
+		return s.prefix
+	}
+	return s.prefix + "\x00" + s.delimiter
+}
+
+// cleanObj is a version to be deleted and the listing page it comes from
+type cleanObj struct {
+	s3.ObjectIdentifier
+	page *listPage
+	// size and extraneous are set only by BucketSyncer, an extraneous object is deleted from the destination
+	size       int64
+	extraneous bool
+	// retry is true for a version failed in the previous run
+	retry bool
+}
+
+// cleanTask holds the state of a single EmptyBucket, BulkJob or BucketSyncer run
+type cleanTask struct {
+	ctx        context.Context
+	bucket     string
+	startTime  time.Time
+	dryRun     bool
+	adaptive   bool
+	objectLock bool
+	// latestOnly skips noncurrent versions and delete markers in the listing
+	latestOnly  bool
+	reqLimiter  *RateLimiter
+	objLimiter  *RateLimiter
+	listed      uint64
+	skipped     uint64
+	bytes       uint64
+	deleted     uint64
+	updated     uint64
+	copied      uint64
+	failed      uint64
+	aborted     uint64
+	abortFailed uint64
+
+	mu       sync.Mutex
+	objErrs  []ObjectError
+	errs     []error
+	trackers map[string]*listTracker
+	// markers are the positions to resume from
+	markers map[string]ListMarker
+	// retries are the versions failed in the previous runs, retryPending is the number of them not handled yet
+	retries      []FailedVersion
+	retryPending int64
+	// failedObjs are the versions failed in this run, to be retried by the next one
+	failedObjs []FailedVersion
+	// base is the progress restored from the checkpoint
+	base Progress
 }
 
 func NewBucketCleaner(svc *s3.S3) *BucketCleaner {
 	c := &BucketCleaner{
-		svc:          svc,
-		deletedCount: 0,
+		svc:         svc,
+		JobOptions:  defaultJobOptions(),
+		BatchLinger: defaultBatchLinger,
 	}
 	return c
 }
 
+func defaultJobOptions() JobOptions {
+	return JobOptions{
+		Progress:         StdoutProgressReporter{},
+		ProgressInterval: time.Second,
+		MaxRetries:       3,
+		RetryBackoff:     defaultRetryBackoff,
+	}
+}
+
 // EmptyBucket is to empty objects in the bucket concurrently.
 // objChanCap is the capacity of channel to store the objects from listObjs
 // multiDel decides whether to delete multiple objects in a request
 func (c *BucketCleaner) EmptyBucket(bucketName string, deleteWorkerNum, objChanCap int, multiDel, deleteBucket bool) error {
+	_, err := c.EmptyBucketWithContext(context.Background(), bucketName, deleteWorkerNum, objChanCap, multiDel, deleteBucket)
+	return err
+}
+
+// EmptyBucketWithContext is the same as EmptyBucket with the addition of the ability to cancel.
+// When ctx is canceled, listing, deleting and aborting multipart uploads stop, and the
+// partial result is returned together with ctx.Err().
+// A non-nil error is also returned when anything is left behind in the bucket,
+// the details of every failure can be found in the result.
+// If CheckpointFile is set, the run resumes from the position saved by the previous unfinished run.
+func (c *BucketCleaner) EmptyBucketWithContext(ctx context.Context, bucketName string, deleteWorkerNum, objChanCap int, multiDel, deleteBucket bool) (*CleanResult, error) {
+	source := cleanSource{
+		listObjs:        c.listObjs,
+		abortMultiparts: c.abortAllMultiparts,
+		resumable:       true,
+	}
+	return c.emptyBucket(ctx, bucketName, deleteWorkerNum, objChanCap, multiDel, deleteBucket, source)
+}
+
+// EmptyBucketFromManifest removes the versions, delete markers and multipart uploads of the bucket
+// recorded in the manifest, entries of other buckets are ignored. Filter is not applied to the entries,
+// and the run is not checkpointed.
+func (c *BucketCleaner) EmptyBucketFromManifest(ctx context.Context, bucketName string, manifest io.Reader, format ManifestFormat, deleteWorkerNum, objChanCap int, multiDel bool) (*CleanResult, error) {
+	reader := NewManifestReader(manifest, format)
+	source := cleanSource{
+		listObjs: func(task *cleanTask, objChannel chan<- cleanObj) {
+			c.listManifest(task, reader, objChannel)
+		},
+	}
+	return c.emptyBucket(ctx, bucketName, deleteWorkerNum, objChanCap, multiDel, false, source)
+}
+
+func (c *BucketCleaner) emptyBucket(ctx context.Context, bucketName string, deleteWorkerNum, objChanCap int, multiDel, deleteBucket bool, source cleanSource) (*CleanResult, error) {
+	action := cleanAction{
+		prepare: func(task *cleanTask) {
+			if !c.DryRun {
+				task.objectLock = c.objectLockEnabled(ctx, bucketName)
+			}
+		},
+		work: c.deleteObj,
+		finish: func(task *cleanTask) error {
+			return c.finishTask(task, deleteBucket)
+		},
+	}
+	if multiDel {
+		action.work = c.deleteObjs
+	}
+
+	task, err := c.runTask(ctx, bucketName, deleteWorkerNum, objChanCap, source, action)
+	result := task.result()
+	result.Completed = err == nil
+	return result, err
+}
+
+// cleanAction is what a task does with the listed versions
+type cleanAction struct {
+	// prepare is called before the listing starts
+	prepare func(*cleanTask)
+	// work is run by every worker until objChannel is closed or the task is canceled
+	work func(task *cleanTask, objChannel <-chan cleanObj)
+	// finish is called after all the workers exit, it returns nil only if the task is completed
+	finish func(*cleanTask) error
+}
+
+// runTask lists the versions of the bucket from source and hands them to workerNum workers of action
+func (c *BucketCleaner) runTask(ctx context.Context, bucketName string, workerNum, objChanCap int, source cleanSource, action cleanAction) (*cleanTask, error) {
+	task := &cleanTask{
+		ctx:       ctx,
+		bucket:    bucketName,
+		startTime: time.Now(),
+		dryRun:    c.DryRun,
+		adaptive:  c.AdaptiveRate,
+	}
+	task.reqLimiter, task.objLimiter = c.reqLimiter, c.objLimiter
+	if task.reqLimiter == nil && (c.RequestsPerSecond > 0 || c.AdaptiveRate) {
+		task.reqLimiter = NewRateLimiter(c.RequestsPerSecond)
+	}
+	if task.objLimiter == nil && c.ObjectsPerSecond > 0 {
+		task.objLimiter = NewRateLimiter(c.ObjectsPerSecond)
+	}
+	if action.prepare != nil {
+		action.prepare(task)
+	}
+
+	var store *checkpointStore
+	if source.resumable && c.CheckpointFile != "" {
+		var err error
+		store, err = c.checkpointStore()
+		if err != nil {
+			return task, fmt.Errorf("read checkpoint: %w", err)
+		}
+		task.resume(store.get(bucketName))
+	}
+
 	var wg sync.WaitGroup
-	wg.Add(deleteWorkerNum + 2)
-	startTime := time.Now()
-	go c.crontabPrintResults(startTime)
-	// objChannel存放实际的对象名
-	objChannel := make(chan s3.ObjectIdentifier, objChanCap)
-	// listObjs并将对象名放入objChannel
+	wg.Add(workerNum + 1)
+	reporter := c.Progress
+	if reporter == nil {
+		reporter = NopProgressReporter{}
+	}
+	interval := c.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	bgCtx, stopBg := context.WithCancel(ctx)
+	defer stopBg()
+	var bgWg sync.WaitGroup
+	bgWg.Add(1)
 	go func() {
-		defer wg.Done()
-		c.listObjs(objChannel, bucketName)
+		defer bgWg.Done()
+		reportProgress(bgCtx, reporter, interval, task.progress)
 	}()
+	if store != nil {
+		bgWg.Add(1)
+		go func() {
+			defer bgWg.Done()
+			c.saveCheckpoints(bgCtx, store, task)
+		}()
+	}
+	// objChannel存放实际的对象名
+	objChannel := make(chan cleanObj, objChanCap)
+	// listObjs并将对象名放入objChannel
 	go func() {
 		defer wg.Done()
-		c.abortAllMultiparts(bucketName)
+		source.listObjs(task, objChannel)
 	}()
+	if source.abortMultiparts != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			source.abortMultiparts(task)
+		}()
+	}
 
-	// 并发删除对象
-	for i := 0; i < deleteWorkerNum; i++ {
-		if multiDel {
-			go func() {
-				defer wg.Done()
-				c.deleteObjs(objChannel, bucketName)
-			}()
-		} else {
-			go func() {
-				defer wg.Done()
-				c.deleteObj(objChannel, bucketName)
-			}()
-		}
+	// 并发处理对象
+	for i := 0; i < workerNum; i++ {
+		go func() {
+			defer wg.Done()
+			action.work(task, objChannel)
+		}()
 	}
 
 	wg.Wait()
-	fmt.Println("all task completed")
+	stopBg()
+	bgWg.Wait()
 
-	if deleteBucket {
-		deleteBucketInput := &s3.DeleteBucketInput{
-			Bucket: aws.String(bucketName),
-		}
-		_, err := c.svc.DeleteBucket(deleteBucketInput)
+	err := action.finish(task)
+
+	if store != nil {
+		var bucketCkpt *BucketCheckpoint
 		if err != nil {
-			fmt.Printf("delete bucket err:%s\n", err)
-			return err
+			bucketCkpt = task.checkpoint()
+		}
+		if ckptErr := store.put(bucketName, bucketCkpt); ckptErr != nil {
+			err = errors.Join(err, fmt.Errorf("write checkpoint: %w", ckptErr))
 		}
-		fmt.Printf("deleted bucket:%s\n", bucketName)
 	}
-	return nil
+
+	p := task.progress()
+	p.Rate = rate(task.base, p)
+	p.Done = true
+	reporter.Report(p)
+
+	return task, err
 }
 
-// DeleteAllBuckets delete all buckets or all buckets contain a specified string of a user
-func (c *BucketCleaner) DeleteAllBuckets(containedStr string) error {
-	listBucketsInput := &s3.ListBucketsInput{}
-	listBucketsOutput, err := c.svc.ListBuckets(listBucketsInput)
-	if err != nil {
+// finishTask returns nil only if the bucket has been emptied, and deletes the bucket then if deleteBucket is true
+func (c *BucketCleaner) finishTask(task *cleanTask, deleteBucket bool) error {
+	if err := task.ctx.Err(); err != nil {
+		return err
+	}
+	if c.Manifest != nil {
+		if err := c.Manifest.Flush(); err != nil {
+			task.addErr(fmt.Errorf("flush manifest: %w", err))
+		}
+	}
+	if err := task.err(); err != nil {
 		return err
 	}
 
-	for _, b := range listBucketsOutput.Buckets {
-		bktName := *b.Name
-		if containedStr == "" || strings.Contains(bktName, containedStr) {
-			c.EmptyBucket(bktName, 3, 1000, true, true)
+	if deleteBucket && !c.DryRun {
+		deleteBucketInput := &s3.DeleteBucketInput{
+			Bucket: aws.String(task.bucket),
+		}
+		_, err := c.svc.DeleteBucketWithContext(task.ctx, deleteBucketInput)
+		if err != nil {
+			return fmt.Errorf("delete bucket %s: %w", task.bucket, err)
 		}
 	}
 	return nil
 }
 
-func (c *BucketCleaner) crontabPrintResults(startTime time.Time) {
-	timeTicker := time.NewTicker(time.Duration(1) * time.Second)
+// checkpointStore returns the store of CheckpointFile, the file is read only once
+func (c *BucketCleaner) checkpointStore() (*checkpointStore, error) {
+	c.ckptMu.Lock()
+	defer c.ckptMu.Unlock()
+
+	if c.ckptStore != nil && c.ckptStore.path == c.CheckpointFile {
+		return c.ckptStore, nil
+	}
+	store, err := newCheckpointStore(c.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	c.ckptStore = store
+	return store, nil
+}
+
+// saveCheckpoints saves the position of the task every CheckpointInterval until ctx is done
+func (c *BucketCleaner) saveCheckpoints(ctx context.Context, store *checkpointStore, task *cleanTask) {
+	interval := c.CheckpointInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	timeTicker := time.NewTicker(interval)
 	defer timeTicker.Stop()
-	tps := 0.0
+
 	for {
-		<-timeTicker.C
-		timeDiff := time.Since(startTime)
-		tps = float64(c.deletedCount) / timeDiff.Seconds()
-		fmt.Printf("TPS:%f\n", tps)
-		if c.deletedCount > 0 && c.deletedCount%10000 == 0 {
-			fmt.Printf("deleted %d objects\n", c.deletedCount)
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeTicker.C:
+		}
+		if err := store.put(task.bucket, task.checkpoint()); err != nil {
+			task.addErr(fmt.Errorf("write checkpoint: %w", err))
 		}
 	}
 }
 
-func (c *BucketCleaner) deleteObjs(objChannel chan s3.ObjectIdentifier, bucketName string) {
-	maxDelNum := 1000
-	objs := make([]*s3.ObjectIdentifier, 0, maxDelNum)
+// DeleteAllBuckets delete all buckets or all buckets contain a specified string of a user
+func (c *BucketCleaner) DeleteAllBuckets(containedStr string) error {
+	opts := DefaultDeleteBucketsOptions()
+	if containedStr != "" {
+		opts.Selector.IncludeRegexp = []*regexp.Regexp{regexp.MustCompile(regexp.QuoteMeta(containedStr))}
+	}
+	_, err := c.DeleteBucketsWithContext(context.Background(), opts)
+	return err
+}
+
+func (c *BucketCleaner) deleteObjs(task *cleanTask, objChannel <-chan cleanObj) {
+	batcher := NewBatcher(objChannel, maxDeleteObjects, c.BatchLinger)
+	batcher.Run(task.ctx, func(objs []cleanObj) {
+		c.doDeleteObjsReq(task, objs)
+	})
+}
+
+func (c *BucketCleaner) doDeleteObjsReq(task *cleanTask, objs []cleanObj) {
+	for attempt := 0; len(objs) > 0; attempt++ {
+		if attempt > 0 && !c.backoff(task, attempt) {
+			return
+		}
+		if !task.wait(len(objs)) {
+			return
+		}
+
+		objIds := make([]*s3.ObjectIdentifier, len(objs))
+		for i := range objs {
+			objIds[i] = &s3.ObjectIdentifier{
+				Key:       objs[i].Key,
+				VersionId: objs[i].VersionId,
+			}
+		}
+		deleteObjectsInput := &s3.DeleteObjectsInput{
+			Bucket: aws.String(task.bucket),
+			Delete: &s3.Delete{
+				Objects: objIds,
+				Quiet:   aws.Bool(true),
+			},
+		}
+		if c.BypassGovernanceRetention {
+			deleteObjectsInput.BypassGovernanceRetention = aws.Bool(true)
+		}
+
+		output, err := c.svc.DeleteObjectsWithContext(task.ctx, deleteObjectsInput)
+		if task.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			task.feedback(err)
+			if isRetryableErr(err) && attempt < c.MaxRetries {
+				continue
+			}
+			for _, obj := range objs {
+				task.addVersionErr(obj.Key, obj.VersionId, err)
+				task.retryLater(obj)
+			}
+			task.done(objs...)
+			return
+		}
+
+		// objects failed with retryable errors are kept in objs for the next attempt
+		failed := make(map[string]*s3.Error, len(output.Errors))
+		throttled := false
+		for _, e := range output.Errors {
+			failed[objKey(e.Key, e.VersionId)] = e
+			throttled = throttled || isThrottlingCode(aws.StringValue(e.Code))
+		}
+		if throttled {
+			task.slowDown()
+		} else {
+			task.speedUp()
+		}
+
+		retries := objs[:0:0]
+		for _, obj := range objs {
+			e, ok := failed[objKey(obj.Key, obj.VersionId)]
+			switch {
+			case !ok:
+				atomic.AddUint64(&task.deleted, 1)
+			case isRetryableCode(aws.StringValue(e.Code)) && attempt < c.MaxRetries:
+				retries = append(retries, obj)
+				continue
+			default:
+				c.failDelete(task, obj, aws.StringValue(e.Code), aws.StringValue(e.Message))
+			}
+			task.done(obj)
+		}
+		objs = retries
+	}
+}
+
+func (c *BucketCleaner) deleteObj(task *cleanTask, objChannel <-chan cleanObj) {
 	for {
 		select {
+		case <-task.ctx.Done():
+			return
 		case obj, ok := <-objChannel:
 			if !ok {
-				// If there are any undeleted objects, delete them first and then exit
-				if len(objs) > 0 {
-					c.doDeleteObjsReq(objs, bucketName)
-				}
 				return
 			}
-			objId := s3.ObjectIdentifier{
-				Key:       obj.Key,
-				VersionId: obj.VersionId,
-			}
-			objs = append(objs, &objId)
-			if len(objs) < maxDelNum {
-				continue
+			if !c.doDeleteObjReq(task, obj) {
+				return
 			}
+		}
+	}
+}
 
-			c.doDeleteObjsReq(objs, bucketName)
-			objs = objs[0:0]
+// doDeleteObjReq deletes a version with retries, it returns false if the task is canceled
+func (c *BucketCleaner) doDeleteObjReq(task *cleanTask, obj cleanObj) bool {
+	deleteObjectInput := c.deleteObjectInput(task, obj)
 
-		default:
-			// If no data is available in the channel, delete the objects directly and continue the next loop
-			if len(objs) > 0 {
-				c.doDeleteObjsReq(objs, bucketName)
-				objs = objs[0:0]
-			}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && !c.backoff(task, attempt) {
+			return false
+		}
+		if !task.wait(1) {
+			return false
+		}
+
+		_, err := c.svc.DeleteObjectWithContext(task.ctx, deleteObjectInput)
+		if task.ctx.Err() != nil {
+			return false
 		}
+		task.feedback(err)
+		if err != nil && isRetryableErr(err) && attempt < c.MaxRetries {
+			continue
+		}
+
+		if err != nil {
+			code, message := errCodeAndMessage(err)
+			c.failDelete(task, obj, code, message)
+		} else {
+			atomic.AddUint64(&task.deleted, 1)
+		}
+		task.done(obj)
+		return true
 	}
 }
 
-func (c *BucketCleaner) doDeleteObjsReq(objs []*s3.ObjectIdentifier, bucketName string) {
-	deleteObjectsInput := &s3.DeleteObjectsInput{
-		Bucket: aws.String(bucketName),
-		Delete: &s3.Delete{
-			Objects: objs,
-			Quiet:   aws.Bool(true),
-		},
+func (c *BucketCleaner) deleteObjectInput(task *cleanTask, obj cleanObj) *s3.DeleteObjectInput {
+	deleteObjectInput := &s3.DeleteObjectInput{
+		Bucket:    aws.String(task.bucket),
+		Key:       obj.Key,
+		VersionId: obj.VersionId,
 	}
+	if c.BypassGovernanceRetention {
+		deleteObjectInput.BypassGovernanceRetention = aws.Bool(true)
+	}
+	return deleteObjectInput
+}
 
-	_, err := c.svc.DeleteObjects(deleteObjectsInput)
-	if err != nil {
-		fmt.Printf("Failed to delete objects. %v\n", err)
-	} else {
-		atomic.AddUint64(&c.deletedCount, 1)
+// backoff sleeps before a retry, the delay is doubled every attempt.
+// It returns false if the task is canceled.
+func (c *BucketCleaner) backoff(task *cleanTask, attempt int) bool {
+	return sleepBackoff(task.ctx, c.RetryBackoff, attempt)
+}
+
+// sleepBackoff sleeps base doubled attempt-1 times, capped at maxRetryBackoff.
+// It returns false if ctx is done.
+func sleepBackoff(ctx context.Context, base time.Duration, attempt int) bool {
+	delay := base
+	if delay <= 0 {
+		delay = defaultRetryBackoff
+	}
+	delay <<= attempt - 1
+	if delay > maxRetryBackoff || delay <= 0 {
+		delay = maxRetryBackoff
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
 }
 
-func (c *BucketCleaner) deleteObj(objChannel chan s3.ObjectIdentifier, bucketName string) {
-	for {
-		select {
-		case obj, ok := <-objChannel:
-			if !ok {
-				return
-			}
-			deleteObjectInput := &s3.DeleteObjectInput{
-				Bucket:    aws.String(bucketName),
-				Key:       obj.Key,
-				VersionId: obj.VersionId,
-			}
+// objKey identifies a version in a DeleteObjects request
+func objKey(key, versionId *string) string {
+	return aws.StringValue(key) + "\x00" + aws.StringValue(versionId)
+}
 
-			_, err := c.svc.DeleteObject(deleteObjectInput)
-			if err != nil {
-				fmt.Printf("Failed to delete object. %v\n", err)
-			} else {
-				atomic.AddUint64(&c.deletedCount, 1)
+// abortAllMultiparts aborts the multipart uploads matching Filter under the listing shards
+func (c *BucketCleaner) abortAllMultiparts(task *cleanTask) {
+	err := listUploads(task.ctx, c.svc, task.bucket, c.Filter.prefix(), func(upload *s3.MultipartUpload) bool {
+		if task.ctx.Err() != nil {
+			return false
+		}
+		if !c.Filter.matchUpload(upload) || !c.inShards(aws.StringValue(upload.Key)) {
+			return true
+		}
+		if c.Manifest != nil || c.DryRun {
+			if !c.recordUpload(task, upload) {
+				return false
 			}
+			if c.DryRun {
+				return true
+			}
+		}
+		abortInput := &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(task.bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		}
+		if !task.wait(0) {
+			return false
 		}
+		_, err := c.svc.AbortMultipartUploadWithContext(task.ctx, abortInput)
+		task.feedback(err)
+		if err != nil {
+			task.addAbortErr(upload.Key, upload.UploadId, err)
+		} else {
+			atomic.AddUint64(&task.aborted, 1)
+		}
+		return true
+	})
+	if err != nil {
+		task.addErr(fmt.Errorf("list multipart uploads of bucket %s: %w", task.bucket, err))
 	}
 }
 
-func (c *BucketCleaner) abortAllMultiparts(bucketName string) {
-	var maxUploads int64
-	maxUploads = 1000
+// listUploads calls fn with every multipart upload under prefix until fn returns false,
+// the pages are walked with both KeyMarker and UploadIdMarker so uploads of the same key are neither skipped nor repeated
+func listUploads(ctx context.Context, svc *s3.S3, bucketName string, prefix *string, fn func(*s3.MultipartUpload) bool) error {
 	input := &s3.ListMultipartUploadsInput{
 		Bucket:     aws.String(bucketName),
-		MaxUploads: &maxUploads,
+		Prefix:     prefix,
+		MaxUploads: aws.Int64(1000),
 	}
+	for {
+		output, err := svc.ListMultipartUploadsWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, upload := range output.Uploads {
+			if !fn(upload) {
+				return nil
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+}
 
-	allUploads, err := c.svc.ListMultipartUploads(input)
+// listObjs lists the shards of the bucket concurrently and closes objChannel when all of them are done
+func (c *BucketCleaner) listObjs(task *cleanTask, objChannel chan<- cleanObj) {
+	defer close(objChannel)
+	if !c.sendRetries(task, objChannel) {
+		return
+	}
+	shards, err := c.listShards(task)
 	if err != nil {
-		fmt.Printf("fail to list multipart uploads. %v\n", err)
+		task.addErr(fmt.Errorf("split listing of bucket %s: %w", task.bucket, err))
 		return
 	}
 
-	listedCount := 0
-	for {
-		if len(allUploads.Uploads) > 0 {
-			listedCount += len(allUploads.Uploads)
-			fmt.Printf("got %d objects of bucket %v\n", listedCount, bucketName)
-			for _, upload := range allUploads.Uploads {
-				abortInput := &s3.AbortMultipartUploadInput{
-					Bucket:   &bucketName,
-					Key:      upload.Key,
-					UploadId: upload.UploadId,
-				}
-				_, err = c.svc.AbortMultipartUpload(abortInput)
-				if err != nil {
-					fmt.Printf("fail to AbortMultipartUpload. %v\n", err)
-				}
+	listWorkerNum := c.ListWorkerNum
+	if listWorkerNum <= 0 {
+		listWorkerNum = 1
+	}
+	shardChannel := make(chan listShard)
+	var wg sync.WaitGroup
+	wg.Add(listWorkerNum)
+	for i := 0; i < listWorkerNum; i++ {
+		go func() {
+			defer wg.Done()
+			for shard := range shardChannel {
+				c.listShard(task, shard, objChannel)
 			}
+		}()
+	}
 
-			input.KeyMarker = allUploads.NextKeyMarker
-			allUploads, err = c.svc.ListMultipartUploads(input)
-			if err != nil {
-				fmt.Printf("fail to list multipart uploads. %v\n", err)
-			}
-		} else {
+	for _, shard := range shards {
+		if task.ctx.Err() != nil {
 			break
 		}
+		shardChannel <- shard
 	}
+	close(shardChannel)
+	wg.Wait()
 }
 
-func (c *BucketCleaner) listObjs(objChannel chan s3.ObjectIdentifier, bucketName string) {
-	fmt.Printf("listing buckets %v\n", bucketName)
-	defer close(objChannel)
+// sendRetries sends the versions failed in the previous runs to objChannel, it returns false if the task is canceled
+func (c *BucketCleaner) sendRetries(task *cleanTask, objChannel chan<- cleanObj) bool {
+	for _, version := range task.retries {
+		obj := cleanObj{
+			ObjectIdentifier: s3.ObjectIdentifier{
+				Key: aws.String(version.Key),
+			},
+			retry: true,
+		}
+		if version.VersionId != "" {
+			obj.VersionId = aws.String(version.VersionId)
+		}
+		select {
+		case <-task.ctx.Done():
+			return false
+		case objChannel <- obj:
+		}
+	}
+	return true
+}
+
+// listShards splits the listing by ListPrefixes or ListDelimiter
+func (c *BucketCleaner) listShards(task *cleanTask) ([]listShard, error) {
+	if len(c.ListPrefixes) > 0 {
+		shards := make([]listShard, len(c.ListPrefixes))
+		for i, prefix := range c.ListPrefixes {
+			shards[i] = listShard{prefix: prefix}
+		}
+		return shards, nil
+	}
+
+	var prefix string
+	if c.Filter != nil {
+		prefix = c.Filter.Prefix
+	}
+	if c.ListDelimiter == "" {
+		return []listShard{{prefix: prefix}}, nil
+	}
+
+	// keys without the delimiter are listed with the delimiter, so that the common prefixes are skipped
+	shards := []listShard{{prefix: prefix, delimiter: c.ListDelimiter}}
 	input := &s3.ListObjectVersionsInput{
-		Bucket: aws.String(bucketName),
-		//KeyMarker: aws.String(""),
+		Bucket:    aws.String(task.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String(c.ListDelimiter),
 	}
-	output, err := c.svc.ListObjectVersions(input)
-	if err != nil {
-		fmt.Printf("fail to list object versions of bucket. %v\n", err)
+	for {
+		output, err := c.svc.ListObjectVersionsWithContext(task.ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, commonPrefix := range output.CommonPrefixes {
+			shards = append(shards, listShard{prefix: aws.StringValue(commonPrefix.Prefix)})
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return shards, nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.VersionIdMarker = output.NextVersionIdMarker
+	}
+}
+
+// inShards checks whether the key is under ListPrefixes
+func (c *BucketCleaner) inShards(key string) bool {
+	if len(c.ListPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.ListPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// listShard sends the versions under a shard to objChannel, resuming from the saved marker
+func (c *BucketCleaner) listShard(task *cleanTask, shard listShard, objChannel chan<- cleanObj) {
+	tracker := task.tracker(shard.key())
+	marker := tracker.position()
+	if marker.Done {
 		return
 	}
 
-	listedCount := 0
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(task.bucket),
+	}
+	if shard.prefix != "" {
+		input.Prefix = aws.String(shard.prefix)
+	}
+	if shard.delimiter != "" {
+		input.Delimiter = aws.String(shard.delimiter)
+	}
+	if marker.KeyMarker != "" {
+		input.KeyMarker = aws.String(marker.KeyMarker)
+		input.VersionIdMarker = aws.String(marker.VersionIdMarker)
+	}
+
 	for {
-		if len(output.Versions) > 0 {
-			listedCount += len(output.Versions)
-			fmt.Printf("got %d objects of bucket %v\n", listedCount, bucketName)
-			for _, object := range output.Versions {
-				objChannel <- s3.ObjectIdentifier{
-					Key:       object.Key,
-					VersionId: object.VersionId,
-				}
-			}
+		output, err := c.svc.ListObjectVersionsWithContext(task.ctx, input)
+		if err != nil {
+			task.addErr(fmt.Errorf("list object versions of bucket %s: %w", task.bucket, err))
+			return
+		}
+		page := tracker.newPage(ListMarker{
+			KeyMarker:       aws.StringValue(output.NextKeyMarker),
+			VersionIdMarker: aws.StringValue(output.NextVersionIdMarker),
+			Done:            !aws.BoolValue(output.IsTruncated),
+		})
 
-			input.KeyMarker = output.NextKeyMarker
-			output, err = c.svc.ListObjectVersions(input)
+		for _, object := range output.Versions {
+			if (task.latestOnly && !aws.BoolValue(object.IsLatest)) || !c.Filter.matchVersion(object) {
+				atomic.AddUint64(&task.skipped, 1)
+				continue
+			}
+			matched, err := c.Filter.matchTags(task.ctx, c.svc, task.bucket, object)
 			if err != nil {
-				fmt.Printf("fail to list objects of bucket. %v\n", err)
+				task.addVersionErr(object.Key, object.VersionId, err)
+				continue
 			}
-		} else if len(output.DeleteMarkers) > 0 {
-			listedCount += len(output.DeleteMarkers)
-			fmt.Printf("got %d objects of bucket %v\n", listedCount, bucketName)
-			for _, object := range output.DeleteMarkers {
-				objChannel <- s3.ObjectIdentifier{
-					Key:       object.Key,
-					VersionId: object.VersionId,
-				}
+			if !matched {
+				atomic.AddUint64(&task.skipped, 1)
+				continue
+			}
+			entry := &ManifestEntry{
+				Bucket:       task.bucket,
+				Key:          aws.StringValue(object.Key),
+				VersionId:    aws.StringValue(object.VersionId),
+				IsLatest:     aws.BoolValue(object.IsLatest),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			}
+			if !c.schedule(task, objChannel, page, entry) {
+				return
+			}
+		}
+		for _, object := range output.DeleteMarkers {
+			if task.latestOnly || !c.Filter.matchDeleteMarker(object) {
+				atomic.AddUint64(&task.skipped, 1)
+				continue
+			}
+			entry := &ManifestEntry{
+				Bucket:       task.bucket,
+				Key:          aws.StringValue(object.Key),
+				VersionId:    aws.StringValue(object.VersionId),
+				DeleteMarker: true,
+				IsLatest:     aws.BoolValue(object.IsLatest),
+				LastModified: aws.TimeValue(object.LastModified),
+			}
+			if !c.schedule(task, objChannel, page, entry) {
+				return
 			}
+		}
+		page.done()
 
-			input.KeyMarker = output.NextKeyMarker
-			output, err = c.svc.ListObjectVersions(input)
-			if err != nil {
-				fmt.Printf("fail to list objects of bucket. %v\n", err)
+		if !aws.BoolValue(output.IsTruncated) {
+			return
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.VersionIdMarker = output.NextVersionIdMarker
+	}
+}
+
+// listManifest reads the entries of the bucket from the manifest, versions and delete markers are sent
+// to objChannel while multipart uploads are aborted directly
+func (c *BucketCleaner) listManifest(task *cleanTask, reader *ManifestReader, objChannel chan<- cleanObj) {
+	defer close(objChannel)
+	for {
+		entry, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			task.addErr(fmt.Errorf("read manifest: %w", err))
+			return
+		}
+		if entry.Bucket != task.bucket {
+			continue
+		}
+
+		if entry.UploadId == "" {
+			if !c.schedule(task, objChannel, nil, entry) {
+				return
+			}
+			continue
+		}
+
+		if task.ctx.Err() != nil {
+			return
+		}
+		if c.Manifest != nil {
+			if err = c.Manifest.Write(entry); err != nil {
+				task.addErr(fmt.Errorf("write manifest: %w", err))
+				return
 			}
+		}
+		atomic.AddUint64(&task.bytes, uint64(entry.Size))
+		if c.DryRun {
+			continue
+		}
+		abortInput := &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(task.bucket),
+			Key:      aws.String(entry.Key),
+			UploadId: aws.String(entry.UploadId),
+		}
+		if !task.wait(0) {
+			return
+		}
+		_, err = c.svc.AbortMultipartUploadWithContext(task.ctx, abortInput)
+		task.feedback(err)
+		if err != nil {
+			task.addAbortErr(abortInput.Key, abortInput.UploadId, err)
 		} else {
-			break
+			atomic.AddUint64(&task.aborted, 1)
+		}
+	}
+}
+
+// schedule records the version in the manifest and sends it to objChannel unless in dry-run mode,
+// it returns false if the task should stop
+func (c *BucketCleaner) schedule(task *cleanTask, objChannel chan<- cleanObj, page *listPage, entry *ManifestEntry) bool {
+	if c.Manifest != nil {
+		if err := c.Manifest.Write(entry); err != nil {
+			task.addErr(fmt.Errorf("write manifest: %w", err))
+			return false
+		}
+	}
+
+	if c.DryRun {
+		atomic.AddUint64(&task.listed, 1)
+		atomic.AddUint64(&task.bytes, uint64(entry.Size))
+		return task.ctx.Err() == nil
+	}
+
+	obj := cleanObj{
+		ObjectIdentifier: s3.ObjectIdentifier{
+			Key: aws.String(entry.Key),
+		},
+		page: page,
+	}
+	if entry.VersionId != "" {
+		obj.VersionId = aws.String(entry.VersionId)
+	}
+	page.add()
+	select {
+	case <-task.ctx.Done():
+		return false
+	case objChannel <- obj:
+		atomic.AddUint64(&task.listed, 1)
+		atomic.AddUint64(&task.bytes, uint64(entry.Size))
+		return true
+	}
+}
+
+// recordUpload writes the multipart upload with the size of its parts into the manifest,
+// it returns false if the task should stop
+func (c *BucketCleaner) recordUpload(task *cleanTask, upload *s3.MultipartUpload) bool {
+	size, err := uploadPartsSize(task.ctx, c.svc, nil, task.bucket, upload.Key, upload.UploadId)
+	if err != nil {
+		task.addErr(fmt.Errorf("list parts of upload %s of %s: %w", aws.StringValue(upload.UploadId), aws.StringValue(upload.Key), err))
+		return task.ctx.Err() == nil
+	}
+	atomic.AddUint64(&task.bytes, uint64(size))
+
+	if c.Manifest == nil {
+		return true
+	}
+	entry := &ManifestEntry{
+		Bucket:       task.bucket,
+		Key:          aws.StringValue(upload.Key),
+		UploadId:     aws.StringValue(upload.UploadId),
+		Size:         size,
+		LastModified: aws.TimeValue(upload.Initiated),
+	}
+	if err = c.Manifest.Write(entry); err != nil {
+		task.addErr(fmt.Errorf("write manifest: %w", err))
+		return false
+	}
+	return true
+}
+
+// uploadPartsSize sums the size of all the uploaded parts of a multipart upload,
+// every page of the parts is requested after waiting on limiter
+func uploadPartsSize(ctx context.Context, svc *s3.S3, limiter *RateLimiter, bucketName string, key, uploadId *string) (int64, error) {
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(bucketName),
+		Key:      key,
+		UploadId: uploadId,
+	}
+
+	var size int64
+	for {
+		if err := limiter.Wait(ctx, 1); err != nil {
+			return 0, err
+		}
+		output, err := svc.ListPartsWithContext(ctx, input)
+		if err != nil {
+			return 0, err
+		}
+		for _, part := range output.Parts {
+			size += aws.Int64Value(part.Size)
 		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return size, nil
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
+
+// wait blocks until a request deleting n versions is allowed, it returns false if the task is canceled
+func (t *cleanTask) wait(n int) bool {
+	if err := t.reqLimiter.Wait(t.ctx, 1); err != nil {
+		return false
+	}
+	return t.objLimiter.Wait(t.ctx, n) == nil
+}
+
+// feedback adjusts the rates by the result of a request
+func (t *cleanTask) feedback(err error) {
+	if err == nil {
+		t.speedUp()
+	} else if isThrottlingErr(err) {
+		t.slowDown()
+	}
+}
+
+func (t *cleanTask) slowDown() {
+	if t.adaptive {
+		t.reqLimiter.Decrease()
+		t.objLimiter.Decrease()
+	}
+}
+
+func (t *cleanTask) speedUp() {
+	if t.adaptive {
+		t.reqLimiter.Increase()
+		t.objLimiter.Increase()
+	}
+}
+
+// done marks the objects as handled, whether they are deleted or not
+func (t *cleanTask) done(objs ...cleanObj) {
+	for _, obj := range objs {
+		obj.page.done()
+		if obj.retry {
+			atomic.AddInt64(&t.retryPending, -1)
+		}
+	}
+}
+
+// retryLater keeps a version failed by a worker, so that the next run can retry it
+func (t *cleanTask) retryLater(obj cleanObj) {
+	if t.ctx.Err() != nil {
+		return
+	}
+	t.mu.Lock()
+	if len(t.failedObjs) < maxCleanErrors {
+		t.failedObjs = append(t.failedObjs, FailedVersion{
+			Key:       aws.StringValue(obj.Key),
+			VersionId: aws.StringValue(obj.VersionId),
+		})
+	}
+	t.mu.Unlock()
+}
+
+// tracker returns the listTracker of a listing prefix
+func (t *cleanTask) tracker(prefix string) *listTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.trackers == nil {
+		t.trackers = make(map[string]*listTracker)
+	}
+	tracker, ok := t.trackers[prefix]
+	if !ok {
+		tracker = newListTracker(t.markers[prefix])
+		t.trackers[prefix] = tracker
+	}
+	return tracker
+}
+
+// resume restores the counts and markers saved by the previous run in the same mode,
+// and the versions failed in the previous runs to be retried before the listing resumes
+func (t *cleanTask) resume(bucketCkpt *BucketCheckpoint) {
+	if bucketCkpt == nil || bucketCkpt.DryRun != t.dryRun {
+		return
+	}
+	t.markers = bucketCkpt.Markers
+	t.listed = bucketCkpt.Listed
+	t.skipped = bucketCkpt.Skipped
+	t.bytes = bucketCkpt.Bytes
+	t.deleted = bucketCkpt.Deleted
+	t.updated = bucketCkpt.Updated
+	t.aborted = bucketCkpt.Aborted
+	t.retries = bucketCkpt.Retries
+	t.retryPending = int64(len(bucketCkpt.Retries))
+	t.base = t.progress()
+}
+
+// checkpoint returns the position of the task, the retries of the previous runs are kept until all of them are handled
+func (t *cleanTask) checkpoint() *BucketCheckpoint {
+	markers := make(map[string]ListMarker)
+	t.mu.Lock()
+	for prefix, marker := range t.markers {
+		markers[prefix] = marker
+	}
+	for prefix, tracker := range t.trackers {
+		markers[prefix] = tracker.position()
+	}
+	retries := append([]FailedVersion(nil), t.failedObjs...)
+	t.mu.Unlock()
+
+	if atomic.LoadInt64(&t.retryPending) > 0 {
+		seen := make(map[FailedVersion]bool, len(retries))
+		for _, version := range retries {
+			seen[version] = true
+		}
+		for _, version := range t.retries {
+			if !seen[version] {
+				retries = append(retries, version)
+			}
+		}
+	}
+
+	return &BucketCheckpoint{
+		Markers:   markers,
+		DryRun:    t.dryRun,
+		Listed:    atomic.LoadUint64(&t.listed),
+		Skipped:   atomic.LoadUint64(&t.skipped),
+		Bytes:     atomic.LoadUint64(&t.bytes),
+		Deleted:   atomic.LoadUint64(&t.deleted),
+		Updated:   atomic.LoadUint64(&t.updated),
+		Failed:    atomic.LoadUint64(&t.failed),
+		Aborted:   atomic.LoadUint64(&t.aborted),
+		Retries:   retries,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// addErr records an error which stops a part of the task, such as listing
+func (t *cleanTask) addErr(err error) {
+	if t.ctx.Err() != nil {
+		// errors caused by cancellation are reported by ctx.Err()
+		return
+	}
+	t.mu.Lock()
+	t.errs = append(t.errs, err)
+	t.mu.Unlock()
+}
+
+func (t *cleanTask) addObjErr(objErr ObjectError) {
+	if objErr.UploadId != "" {
+		atomic.AddUint64(&t.abortFailed, 1)
+	} else {
+		atomic.AddUint64(&t.failed, 1)
+	}
+	t.mu.Lock()
+	if len(t.objErrs) < maxCleanErrors {
+		t.objErrs = append(t.objErrs, objErr)
+	}
+	t.mu.Unlock()
+}
+
+func (t *cleanTask) addVersionErr(key, versionId *string, err error) {
+	if t.ctx.Err() != nil {
+		return
+	}
+	code, message := errCodeAndMessage(err)
+	t.addObjErr(ObjectError{
+		Key:       aws.StringValue(key),
+		VersionId: aws.StringValue(versionId),
+		Code:      code,
+		Message:   message,
+	})
+}
+
+func (t *cleanTask) addAbortErr(key, uploadId *string, err error) {
+	if t.ctx.Err() != nil {
+		return
+	}
+	code, message := errCodeAndMessage(err)
+	t.addObjErr(ObjectError{
+		Key:      aws.StringValue(key),
+		UploadId: aws.StringValue(uploadId),
+		Code:     code,
+		Message:  message,
+	})
+}
+
+// err returns a non-nil error if anything is left behind in the bucket
+func (t *cleanTask) err() error {
+	errs := t.errors()
+	if failed := atomic.LoadUint64(&t.failed); failed > 0 {
+		errs = append(errs, fmt.Errorf("failed to delete %d objects of bucket %s", failed, t.bucket))
+	}
+	if abortFailed := atomic.LoadUint64(&t.abortFailed); abortFailed > 0 {
+		errs = append(errs, fmt.Errorf("failed to abort %d multipart uploads of bucket %s", abortFailed, t.bucket))
+	}
+	return errors.Join(errs...)
+}
+
+// errors returns the errors which are not about a single key
+func (t *cleanTask) errors() []error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]error(nil), t.errs...)
+}
+
+func (t *cleanTask) progress() Progress {
+	return Progress{
+		Bucket:  t.bucket,
+		Listed:  atomic.LoadUint64(&t.listed),
+		Deleted: atomic.LoadUint64(&t.deleted),
+		Updated: atomic.LoadUint64(&t.updated),
+		Copied:  atomic.LoadUint64(&t.copied),
+		Failed:  atomic.LoadUint64(&t.failed),
+		Aborted: atomic.LoadUint64(&t.aborted),
+		Elapsed: time.Since(t.startTime),
+	}
+}
+
+func (t *cleanTask) result() *CleanResult {
+	t.mu.Lock()
+	objErrs := append([]ObjectError(nil), t.objErrs...)
+	t.mu.Unlock()
+
+	return &CleanResult{
+		Bucket:            t.bucket,
+		ObjectLockEnabled: t.objectLock,
+		Listed:            atomic.LoadUint64(&t.listed),
+		Skipped:           atomic.LoadUint64(&t.skipped),
+		Bytes:             atomic.LoadUint64(&t.bytes),
+		Deleted:           atomic.LoadUint64(&t.deleted),
+		Failed:            atomic.LoadUint64(&t.failed),
+		Aborted:           atomic.LoadUint64(&t.aborted),
+		Errors:            objErrs,
+		Elapsed:           time.Since(t.startTime),
+	}
+}
+
+// errCodeAndMessage extracts the error code and message of a failed request
+func errCodeAndMessage(err error) (string, string) {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code(), aerr.Message()
 	}
+	return "", err.Error()
 }
@@ -1,12 +1,21 @@
 package s3box
 
 import (
+	"context"
+	"encoding/xml"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func buildS3Client(t *testing.T) *s3.S3 {
@@ -25,6 +34,135 @@ func buildS3Client(t *testing.T) *s3.S3 {
 	return svc
 }
 
+// buildMockS3Client returns a client of a local server served by handler
+func buildMockS3Client(t *testing.T, handler http.Handler) *s3.S3 {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("mock-region"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("ak", "sk", ""),
+	}))
+	return s3.New(sess)
+}
+
+// mockFailure makes the deletes of a key fail with code for times times, or always if times is negative
+type mockFailure struct {
+	code  string
+	times int
+}
+
+// mockBucket is a versioned bucket with a single version "v1" of every key, served by a local server
+type mockBucket struct {
+	mu       sync.Mutex
+	keys     map[string]bool
+	failures map[string]*mockFailure
+	// lists is the number of ListObjectVersions requests received
+	lists int
+}
+
+func newMockBucket(keys ...string) *mockBucket {
+	b := &mockBucket{
+		keys:     make(map[string]bool),
+		failures: make(map[string]*mockFailure),
+	}
+	for _, key := range keys {
+		b.keys[key] = true
+	}
+	return b
+}
+
+// remaining returns the keys left in the bucket in order
+func (b *mockBucket) remaining() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := make([]string, 0, len(b.keys))
+	for key := range b.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// delete removes the key, it returns the code of the failure if it fails
+func (b *mockBucket) delete(key string) string {
+	if failure, ok := b.failures[key]; ok && failure.times != 0 {
+		failure.times--
+		return failure.code
+	}
+	delete(b.keys, key)
+	return ""
+}
+
+func (b *mockBucket) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	query := req.URL.Query()
+	key := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	w.Header().Set("Content-Type", "application/xml")
+	switch {
+	case req.Method == "GET" && query.Has("versions"):
+		b.lists++
+		keys := make([]string, 0, len(b.keys))
+		for key := range b.keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprint(w, `<ListVersionsResult><IsTruncated>false</IsTruncated>`)
+		for _, key := range keys {
+			fmt.Fprintf(w, `<Version><Key>%s</Key><VersionId>v1</VersionId><IsLatest>true</IsLatest><Size>1</Size></Version>`, key)
+		}
+		fmt.Fprint(w, `</ListVersionsResult>`)
+	case req.Method == "GET" && query.Has("uploads"):
+		fmt.Fprint(w, `<ListMultipartUploadsResult><IsTruncated>false</IsTruncated></ListMultipartUploadsResult>`)
+	case req.Method == "POST" && query.Has("delete"):
+		var input struct {
+			Objects []struct {
+				Key       string
+				VersionId string
+			} `xml:"Object"`
+		}
+		if err := xml.NewDecoder(req.Body).Decode(&input); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `<DeleteResult>`)
+		for _, obj := range input.Objects {
+			if code := b.delete(obj.Key); code != "" {
+				fmt.Fprintf(w, `<Error><Key>%s</Key><VersionId>%s</VersionId><Code>%s</Code><Message>%s</Message></Error>`,
+					obj.Key, obj.VersionId, code, strings.ToLower(code))
+			}
+		}
+		fmt.Fprint(w, `</DeleteResult>`)
+	case req.Method == "DELETE" && len(key) == 2:
+		if code := b.delete(key[1]); code != "" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message></Error>`, code, strings.ToLower(code))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == "DELETE":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchConfiguration</Code><Message>not found</Message></Error>`)
+	}
+}
+
+// buildMockCleaner returns a quiet cleaner of the bucket with fast retries
+func buildMockCleaner(t *testing.T, bucket *mockBucket) *BucketCleaner {
+	t.Helper()
+	c := NewBucketCleaner(buildMockS3Client(t, bucket))
+	c.Progress = NopProgressReporter{}
+	c.RetryBackoff = time.Millisecond
+	c.BatchLinger = 0
+	return c
+}
+
 func TestBucketCleaner_DeleteAllBuckets(t *testing.T) {
 	svc := buildS3Client(t)
 	bc := NewBucketCleaner(svc)
@@ -88,3 +226,130 @@ func TestBucketCleaner_EmptyBucket(t *testing.T) {
 		}
 	})
 }
+
+func TestBucketCleaner_EmptyBucketWithContext(t *testing.T) {
+	svc := buildS3Client(t)
+	bc := NewBucketCleaner(svc)
+
+	Convey("TestBucketCleaner_EmptyBucketWithContext", t, func() {
+		canceledCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		type args struct {
+			ctx             context.Context
+			bucket          string
+			deleteWorkerNum int
+			objChanCap      int
+			multiDel        bool
+			deleteBucket    bool
+		}
+		tests := []struct {
+			name    string
+			args    args
+			want    error
+			wantErr bool
+		}{
+			{"EmptyBucketWithContext should stop when canceled",
+				args{canceledCtx, "abc", 5, 1000, true, true},
+				context.Canceled,
+				true,
+			},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := bc.EmptyBucketWithContext(tt.args.ctx, tt.args.bucket, tt.args.deleteWorkerNum, tt.args.objChanCap, tt.args.multiDel, tt.args.deleteBucket)
+				So(err, ShouldEqual, tt.want)
+				So(got, ShouldNotBeNil)
+				So(got.Bucket, ShouldEqual, tt.args.bucket)
+				So(got.Completed, ShouldBeFalse)
+				So(got.Failed, ShouldEqual, 0)
+				So(got.Errors, ShouldBeEmpty)
+			})
+		}
+	})
+}
+
+func TestBucketCleaner_doDeleteObjsReq(t *testing.T) {
+	Convey("TestBucketCleaner_doDeleteObjsReq", t, func() {
+		tests := []struct {
+			name        string
+			failures    map[string]*mockFailure
+			multiDel    bool
+			wantDeleted uint64
+			wantFailed  []string
+			wantCodes   []string
+		}{
+			{"per-key errors should be collected", map[string]*mockFailure{
+				"b": {"AccessDenied", -1},
+			}, true, 2, []string{"b"}, []string{"AccessDenied"}},
+			{"retryable per-key errors should be retried", map[string]*mockFailure{
+				"a": {"InternalError", 1},
+				"c": {"SlowDown", 2},
+			}, true, 3, nil, nil},
+			{"per-key errors should be collected after the retries", map[string]*mockFailure{
+				"a": {"InternalError", -1},
+				"c": {"AccessDenied", -1},
+			}, true, 1, []string{"a", "c"}, []string{"InternalError", "AccessDenied"}},
+			{"errors of single deletes should be collected", map[string]*mockFailure{
+				"b": {"AccessDenied", -1},
+			}, false, 2, []string{"b"}, []string{"AccessDenied"}},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				bucket := newMockBucket("a", "b", "c")
+				bucket.failures = tt.failures
+				c := buildMockCleaner(t, bucket)
+
+				got, err := c.EmptyBucketWithContext(context.Background(), "abc", 1, 10, tt.multiDel, false)
+				So(got.Deleted, ShouldEqual, tt.wantDeleted)
+				So(got.Failed, ShouldEqual, len(tt.wantFailed))
+				So(got.Completed, ShouldEqual, len(tt.wantFailed) == 0)
+				So(bucket.remaining(), ShouldResemble, append([]string{}, tt.wantFailed...))
+				if len(tt.wantFailed) == 0 {
+					So(err, ShouldBeNil)
+					return
+				}
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, fmt.Sprintf("failed to delete %d objects", len(tt.wantFailed)))
+				sort.Slice(got.Errors, func(i, j int) bool { return got.Errors[i].Key < got.Errors[j].Key })
+				So(got.Errors, ShouldHaveLength, len(tt.wantFailed))
+				for i, objErr := range got.Errors {
+					So(objErr.Key, ShouldEqual, tt.wantFailed[i])
+					So(objErr.VersionId, ShouldEqual, "v1")
+					So(objErr.Code, ShouldEqual, tt.wantCodes[i])
+				}
+			})
+		}
+	})
+}
+
+func TestBucketCleaner_listShards(t *testing.T) {
+	svc := buildS3Client(t)
+	bc := NewBucketCleaner(svc)
+
+	Convey("TestBucketCleaner_listShards", t, func() {
+		task := &cleanTask{ctx: context.Background(), bucket: "abc"}
+
+		Convey("whole bucket should be a single shard", func() {
+			got, err := bc.listShards(task)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, []listShard{{prefix: ""}})
+		})
+
+		Convey("ListPrefixes should be the shards", func() {
+			bc.ListPrefixes = []string{"a/", "b/"}
+			got, err := bc.listShards(task)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, []listShard{{prefix: "a/"}, {prefix: "b/"}})
+			So(bc.inShards("a/1.txt"), ShouldBeTrue)
+			So(bc.inShards("c/1.txt"), ShouldBeFalse)
+		})
+
+		Convey("shard of keys without the delimiter should have its own checkpoint key", func() {
+			So(listShard{prefix: "logs/"}.key(), ShouldEqual, "logs/")
+			So(listShard{prefix: "logs/", delimiter: "/"}.key(), ShouldNotEqual, "logs/")
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package s3box
+
+import (
+	"context"
+	"time"
+)
+
+// Batcher groups the items received from a channel into batches of at most size items.
+// A batch is flushed as soon as it is full, or linger has passed since its first item arrived.
+// With a zero linger, a batch holds the items which are ready in the channel without waiting.
+type Batcher[T any] struct {
+	in     <-chan T
+	size   int
+	linger time.Duration
+}
+
+func NewBatcher[T any](in <-chan T, size int, linger time.Duration) *Batcher[T] {
+	if size <= 0 {
+		size = 1
+	}
+	b := &Batcher[T]{
+		in:     in,
+		size:   size,
+		linger: linger,
+	}
+	return b
+}
+
+// Next blocks until a batch is ready. It returns false when the channel is closed and drained,
+// or when ctx is done, in which case the items collected are dropped.
+func (b *Batcher[T]) Next(ctx context.Context) ([]T, bool) {
+	var batch []T
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case item, ok := <-b.in:
+		if !ok {
+			return nil, false
+		}
+		batch = make([]T, 0, b.size)
+		batch = append(batch, item)
+	}
+
+	if b.linger <= 0 {
+		for len(batch) < b.size {
+			select {
+			case <-ctx.Done():
+				return nil, false
+			case item, ok := <-b.in:
+				if !ok {
+					return batch, true
+				}
+				batch = append(batch, item)
+			default:
+				return batch, true
+			}
+		}
+		return batch, true
+	}
+
+	timer := time.NewTimer(b.linger)
+	defer timer.Stop()
+	for len(batch) < b.size {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case item, ok := <-b.in:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, item)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// Run calls flush with every batch until the channel is closed and drained or ctx is done
+func (b *Batcher[T]) Run(ctx context.Context, flush func(batch []T)) {
+	for {
+		batch, ok := b.Next(ctx)
+		if !ok {
+			return
+		}
+		flush(batch)
+	}
+}
@@ -0,0 +1,88 @@
+package s3box
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestBatcher_Next(t *testing.T) {
+	Convey("TestBatcher_Next", t, func() {
+		Convey("full batch should be flushed without waiting for linger", func() {
+			in := make(chan int, 10)
+			for i := 0; i < 5; i++ {
+				in <- i
+			}
+			b := NewBatcher(in, 3, time.Hour)
+			got, ok := b.Next(context.Background())
+			So(ok, ShouldBeTrue)
+			So(got, ShouldResemble, []int{0, 1, 2})
+		})
+
+		Convey("partial batch should be flushed after linger", func() {
+			in := make(chan int, 10)
+			in <- 1
+			b := NewBatcher(in, 3, 50*time.Millisecond)
+			start := time.Now()
+			got, ok := b.Next(context.Background())
+			So(ok, ShouldBeTrue)
+			So(got, ShouldResemble, []int{1})
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+		})
+
+		Convey("zero linger should flush the ready items", func() {
+			in := make(chan int, 10)
+			in <- 1
+			in <- 2
+			b := NewBatcher(in, 3, 0)
+			got, ok := b.Next(context.Background())
+			So(ok, ShouldBeTrue)
+			So(got, ShouldResemble, []int{1, 2})
+		})
+
+		Convey("closed channel should flush the rest and stop", func() {
+			in := make(chan int, 10)
+			in <- 1
+			close(in)
+			b := NewBatcher(in, 3, time.Hour)
+			got, ok := b.Next(context.Background())
+			So(ok, ShouldBeTrue)
+			So(got, ShouldResemble, []int{1})
+			_, ok = b.Next(context.Background())
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("canceled ctx should stop waiting", func() {
+			in := make(chan int)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, ok := NewBatcher(in, 3, time.Hour).Next(ctx)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestBatcher_Run(t *testing.T) {
+	Convey("TestBatcher_Run", t, func() {
+		in := make(chan int)
+		go func() {
+			for i := 0; i < 2500; i++ {
+				in <- i
+			}
+			close(in)
+		}()
+
+		var batches [][]int
+		NewBatcher(in, 1000, 10*time.Millisecond).Run(context.Background(), func(batch []int) {
+			batches = append(batches, batch)
+		})
+
+		total := 0
+		for _, batch := range batches {
+			So(len(batch), ShouldBeLessThanOrEqualTo, 1000)
+			total += len(batch)
+		}
+		So(total, ShouldEqual, 2500)
+	})
+}
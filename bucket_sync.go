@@ -0,0 +1,564 @@
+package s3box
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CopyMode chooses how a BucketSyncer copies objects
+type CopyMode int
+
+const (
+	// CopyAuto copies server side if both clients use the same endpoint and access key, and streams otherwise.
+	// It falls back to streaming if a server side copy is denied.
+	CopyAuto CopyMode = iota
+	// CopyServerSide copies by CopyObject, or UploadPartCopy for objects larger than 5GiB
+	CopyServerSide
+	// CopyStreaming downloads objects from the source and uploads them to the destination
+	CopyStreaming
+)
+
+const (
+	// maxCopyObjectSize is the largest object CopyObject accepts
+	maxCopyObjectSize   = 5 * 1024 * 1024 * 1024
+	defaultCopyPartSize = 64 * 1024 * 1024
+	maxUploadParts      = 10000
+)
+
+// BucketSyncer copies the latest objects of a bucket to another one, which can be on another endpoint.
+// Objects already in the destination with the same size and ETag are skipped, so a run can be repeated
+// to copy only the changes.
+type BucketSyncer struct {
+	src *s3.S3
+	dst *s3.S3
+
+	// JobOptions are the settings of every run. Filter selects the source objects by Prefix, KeyRegexp,
+	// times and sizes, and destination objects not matching Prefix and KeyRegexp are never deleted as extraneous.
+	// DryRun compares the buckets without copying or deleting anything.
+	// Manifest, CheckpointFile, ListPrefixes and ListDelimiter are not supported.
+	JobOptions
+
+	// CopyMode is CopyAuto by default
+	CopyMode CopyMode
+	// DeleteExtraneous deletes the destination objects which do not exist in the source
+	DeleteExtraneous bool
+	// PartSize is the part size of multipart copies and uploads, 64MiB by default.
+	// It is raised for objects which would need more than 10000 parts.
+	PartSize int64
+}
+
+// SyncResult tells how far a sync run got, it is partial when the run is canceled
+type SyncResult struct {
+	SrcBucket string
+	DstBucket string
+	// Listed is the number of source objects matching the filter
+	Listed uint64
+	// Skipped is the number of source objects excluded by the filter
+	Skipped uint64
+	// UpToDate is the number of objects already in the destination
+	UpToDate uint64
+	Copied   uint64
+	// Bytes is the total size of copied objects
+	Bytes uint64
+	// Extraneous is the number of destination objects found missing in the source when DeleteExtraneous is set,
+	// they are deleted unless in dry-run mode
+	Extraneous uint64
+	// Deleted is the number of extraneous objects deleted from the destination
+	Deleted uint64
+	Failed  uint64
+	// Errors holds the per-key errors of copying and deleting objects,
+	// at most maxCleanErrors of them are kept while Failed always counts all the failures
+	Errors  []ObjectError
+	Elapsed time.Duration
+	// Completed is true only when both buckets have been walked without being canceled
+	Completed bool
+}
+
+// syncTask is a sync run, the embedded cleanTask lists the source bucket and counts the copies
+type syncTask struct {
+	*cleanTask
+	dstBucket string
+	// serverSide is cleared when a server side copy is denied in CopyAuto mode
+	serverSide atomic.Bool
+	upToDate   uint64
+	extraneous uint64
+}
+
+func NewBucketSyncer(src, dst *s3.S3) *BucketSyncer {
+	s := &BucketSyncer{
+		src:        src,
+		dst:        dst,
+		JobOptions: defaultJobOptions(),
+		PartSize:   defaultCopyPartSize,
+	}
+	return s
+}
+
+// SyncWithContext copies the objects of srcBucket missing or changed in dstBucket with syncWorkerNum workers,
+// opChanCap is the capacity of the channel between the lister and the workers
+func (s *BucketSyncer) SyncWithContext(ctx context.Context, srcBucket, dstBucket string, syncWorkerNum, opChanCap int) (*SyncResult, error) {
+	if err := s.validate(); err != nil {
+		return &SyncResult{SrcBucket: srcBucket, DstBucket: dstBucket}, err
+	}
+
+	// every run drives its workers with a cleaner of its own, so that concurrent runs do not share the options
+	cleaner := NewBucketCleaner(s.src)
+	cleaner.JobOptions = s.JobOptions
+	task := &syncTask{dstBucket: dstBucket}
+	task.serverSide.Store(s.serverSide())
+	source := cleanSource{
+		listObjs: func(_ *cleanTask, objChannel chan<- cleanObj) {
+			s.listDiff(task, objChannel)
+		},
+	}
+	action := cleanAction{
+		prepare: func(t *cleanTask) {
+			task.cleanTask = t
+		},
+		work: func(_ *cleanTask, objChannel <-chan cleanObj) {
+			s.syncObjs(task, objChannel)
+		},
+		finish: func(*cleanTask) error {
+			return task.finish()
+		},
+	}
+
+	_, err := cleaner.runTask(ctx, srcBucket, syncWorkerNum, opChanCap, source, action)
+	result := task.result()
+	return &SyncResult{
+		SrcBucket:  srcBucket,
+		DstBucket:  dstBucket,
+		Listed:     result.Listed,
+		Skipped:    result.Skipped,
+		UpToDate:   atomic.LoadUint64(&task.upToDate),
+		Copied:     atomic.LoadUint64(&task.copied),
+		Bytes:      result.Bytes,
+		Extraneous: atomic.LoadUint64(&task.extraneous),
+		Deleted:    result.Deleted,
+		Failed:     result.Failed,
+		Errors:     result.Errors,
+		Elapsed:    result.Elapsed,
+		Completed:  err == nil,
+	}, err
+}
+
+// validate rejects the options BucketSyncer does not support
+func (s *BucketSyncer) validate() error {
+	if s.Filter != nil && (len(s.Filter.Tags) > 0 || s.Filter.NoncurrentOnly || s.Filter.DeleteMarkersOnly) {
+		return errors.New("filter of BucketSyncer supports only Prefix, KeyRegexp, times and sizes")
+	}
+	if s.Manifest != nil || s.CheckpointFile != "" || len(s.ListPrefixes) > 0 || s.ListDelimiter != "" {
+		return errors.New("BucketSyncer supports neither Manifest, CheckpointFile, ListPrefixes nor ListDelimiter")
+	}
+	return nil
+}
+
+// serverSide tells whether objects can be copied by CopyObject. In CopyAuto mode the destination client
+// must be able to read the source, so both clients should use the same endpoint and access key.
+func (s *BucketSyncer) serverSide() bool {
+	switch s.CopyMode {
+	case CopyServerSide:
+		return true
+	case CopyStreaming:
+		return false
+	}
+	return s.src.Endpoint == s.dst.Endpoint && sameAccessKey(s.src.Config.Credentials, s.dst.Config.Credentials)
+}
+
+// sameAccessKey reports whether both credentials have the same access key
+func sameAccessKey(a, b *credentials.Credentials) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	aValue, err := a.Get()
+	if err != nil {
+		return false
+	}
+	bValue, err := b.Get()
+	return err == nil && aValue.AccessKeyID == bValue.AccessKeyID
+}
+
+// listDiff walks the sorted listings of both buckets side by side,
+// the objects to be copied or deleted are sent to objChannel
+func (s *BucketSyncer) listDiff(task *syncTask, objChannel chan<- cleanObj) {
+	defer close(objChannel)
+	srcLister := newKeyLister(s.src, task.bucket, s.Filter.prefix())
+	dstLister := newKeyLister(s.dst, task.dstBucket, s.Filter.prefix())
+
+	srcObj, err := srcLister.next(task.ctx)
+	if err != nil {
+		task.addErr(fmt.Errorf("list objects of bucket %s: %w", task.bucket, err))
+		return
+	}
+	dstObj, err := dstLister.next(task.ctx)
+	if err != nil {
+		task.addErr(fmt.Errorf("list objects of bucket %s: %w", task.dstBucket, err))
+		return
+	}
+
+	for srcObj != nil || dstObj != nil {
+		advanceSrc, advanceDst := true, true
+		switch {
+		case dstObj == nil || (srcObj != nil && aws.StringValue(srcObj.Key) < aws.StringValue(dstObj.Key)):
+			advanceDst = false
+			if !s.Filter.matchObject(srcObj) {
+				atomic.AddUint64(&task.skipped, 1)
+				break
+			}
+			if !s.schedule(task, objChannel, syncObj(srcObj, false)) {
+				return
+			}
+		case srcObj == nil || aws.StringValue(srcObj.Key) > aws.StringValue(dstObj.Key):
+			advanceSrc = false
+			if !s.DeleteExtraneous || (s.Filter != nil && !s.Filter.matchKey(aws.StringValue(dstObj.Key))) {
+				break
+			}
+			if !s.schedule(task, objChannel, syncObj(dstObj, true)) {
+				return
+			}
+		default:
+			if !s.Filter.matchObject(srcObj) {
+				atomic.AddUint64(&task.skipped, 1)
+				break
+			}
+			if upToDate(srcObj, dstObj) {
+				atomic.AddUint64(&task.listed, 1)
+				atomic.AddUint64(&task.upToDate, 1)
+				break
+			}
+			if !s.schedule(task, objChannel, syncObj(srcObj, false)) {
+				return
+			}
+		}
+
+		if advanceSrc {
+			if srcObj, err = srcLister.next(task.ctx); err != nil {
+				task.addErr(fmt.Errorf("list objects of bucket %s: %w", task.bucket, err))
+				return
+			}
+		}
+		if advanceDst {
+			if dstObj, err = dstLister.next(task.ctx); err != nil {
+				task.addErr(fmt.Errorf("list objects of bucket %s: %w", task.dstBucket, err))
+				return
+			}
+		}
+	}
+}
+
+// syncObj is the object to be copied from the source, or deleted from the destination if it is extraneous
+func syncObj(obj *s3.Object, extraneous bool) cleanObj {
+	return cleanObj{
+		ObjectIdentifier: s3.ObjectIdentifier{
+			Key: obj.Key,
+		},
+		size:       aws.Int64Value(obj.Size),
+		extraneous: extraneous,
+	}
+}
+
+// schedule sends an object to the workers unless in dry-run mode, it returns false if the task is canceled
+func (s *BucketSyncer) schedule(task *syncTask, objChannel chan<- cleanObj, obj cleanObj) bool {
+	count := &task.listed
+	if obj.extraneous {
+		count = &task.extraneous
+	}
+	if s.DryRun {
+		atomic.AddUint64(count, 1)
+		return task.ctx.Err() == nil
+	}
+
+	select {
+	case <-task.ctx.Done():
+		return false
+	case objChannel <- obj:
+		atomic.AddUint64(count, 1)
+		return true
+	}
+}
+
+func (s *BucketSyncer) syncObjs(task *syncTask, objChannel <-chan cleanObj) {
+	for {
+		select {
+		case <-task.ctx.Done():
+			return
+		case obj, ok := <-objChannel:
+			if !ok {
+				return
+			}
+			if !s.doSyncReq(task, obj) {
+				return
+			}
+		}
+	}
+}
+
+// doSyncReq copies or deletes an object with retries, it returns false if the task is canceled
+func (s *BucketSyncer) doSyncReq(task *syncTask, obj cleanObj) bool {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && !sleepBackoff(task.ctx, s.RetryBackoff, attempt) {
+			return false
+		}
+		if !task.wait(1) {
+			return false
+		}
+
+		var err error
+		if obj.extraneous {
+			_, err = s.dst.DeleteObjectWithContext(task.ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(task.dstBucket),
+				Key:    obj.Key,
+			})
+		} else {
+			err = s.transfer(task, obj)
+		}
+		if task.ctx.Err() != nil {
+			return false
+		}
+		task.feedback(err)
+		if err != nil && isRetryableErr(err) && attempt < s.MaxRetries {
+			continue
+		}
+
+		switch {
+		case err != nil:
+			task.addVersionErr(obj.Key, nil, err)
+		case obj.extraneous:
+			atomic.AddUint64(&task.deleted, 1)
+		default:
+			atomic.AddUint64(&task.copied, 1)
+			atomic.AddUint64(&task.bytes, uint64(obj.size))
+		}
+		return true
+	}
+}
+
+// transfer copies an object server side if possible, in CopyAuto mode a denied copy falls back to streaming,
+// and so do the rest of objects of the task
+func (s *BucketSyncer) transfer(task *syncTask, obj cleanObj) error {
+	if !task.serverSide.Load() {
+		return s.streamObj(task, obj)
+	}
+	err := s.copyObj(task, obj)
+	if err != nil && s.CopyMode == CopyAuto && isAccessDenied(err) {
+		task.serverSide.Store(false)
+		return s.streamObj(task, obj)
+	}
+	return err
+}
+
+// isAccessDenied reports whether the request is denied, such as a copy from a bucket of another account
+func isAccessDenied(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusForbidden {
+		return true
+	}
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == "AccessDenied"
+}
+
+// copyObj copies an object server side, objects larger than 5GiB are copied part by part
+func (s *BucketSyncer) copyObj(task *syncTask, obj cleanObj) error {
+	source := copySource(task.bucket, aws.StringValue(obj.Key))
+	if obj.size <= maxCopyObjectSize {
+		_, err := s.dst.CopyObjectWithContext(task.ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(task.dstBucket),
+			Key:        obj.Key,
+			CopySource: aws.String(source),
+		})
+		return err
+	}
+
+	head, err := s.src.HeadObjectWithContext(task.ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(task.bucket),
+		Key:    obj.Key,
+	})
+	if err != nil {
+		return err
+	}
+	upload, err := s.dst.CreateMultipartUploadWithContext(task.ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(task.dstBucket),
+		Key:                obj.Key,
+		CacheControl:       head.CacheControl,
+		ContentDisposition: head.ContentDisposition,
+		ContentEncoding:    head.ContentEncoding,
+		ContentLanguage:    head.ContentLanguage,
+		ContentType:        head.ContentType,
+		Metadata:           head.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	parts, err := s.copyParts(task, obj, source, head.ETag, upload.UploadId)
+	if err == nil {
+		_, err = s.dst.CompleteMultipartUploadWithContext(task.ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(task.dstBucket),
+			Key:             obj.Key,
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		// the context may be canceled already, the upload is aborted anyway
+		_, _ = s.dst.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(task.dstBucket),
+			Key:      obj.Key,
+			UploadId: upload.UploadId,
+		})
+	}
+	return err
+}
+
+// copyParts copies the ranges of an object into a multipart upload,
+// eTag makes sure every part comes from the same version
+func (s *BucketSyncer) copyParts(task *syncTask, obj cleanObj, source string, eTag, uploadId *string) ([]*s3.CompletedPart, error) {
+	partSize := s.partSize(obj.size)
+	var parts []*s3.CompletedPart
+	for offset, partNumber := int64(0), int64(1); offset < obj.size; offset, partNumber = offset+partSize, partNumber+1 {
+		end := min(offset+partSize, obj.size) - 1
+		output, err := s.dst.UploadPartCopyWithContext(task.ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(task.dstBucket),
+			Key:               obj.Key,
+			UploadId:          uploadId,
+			PartNumber:        aws.Int64(partNumber),
+			CopySource:        aws.String(source),
+			CopySourceIfMatch: eTag,
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       output.CopyPartResult.ETag,
+			PartNumber: aws.Int64(partNumber),
+		})
+	}
+	return parts, nil
+}
+
+// streamObj downloads an object from the source and uploads it to the destination without buffering it all
+func (s *BucketSyncer) streamObj(task *syncTask, obj cleanObj) error {
+	object, err := s.src.GetObjectWithContext(task.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(task.bucket),
+		Key:    obj.Key,
+	})
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close()
+
+	uploader := s3manager.NewUploaderWithClient(s.dst, func(u *s3manager.Uploader) {
+		u.PartSize = s.partSize(obj.size)
+	})
+	_, err = uploader.UploadWithContext(task.ctx, &s3manager.UploadInput{
+		Bucket:             aws.String(task.dstBucket),
+		Key:                obj.Key,
+		Body:               object.Body,
+		CacheControl:       object.CacheControl,
+		ContentDisposition: object.ContentDisposition,
+		ContentEncoding:    object.ContentEncoding,
+		ContentLanguage:    object.ContentLanguage,
+		ContentType:        object.ContentType,
+		Metadata:           object.Metadata,
+	})
+	return err
+}
+
+// partSize returns PartSize, raised to keep the parts of an object within the limit
+func (s *BucketSyncer) partSize(size int64) int64 {
+	partSize := s.PartSize
+	if partSize < s3manager.MinUploadPartSize {
+		partSize = defaultCopyPartSize
+	}
+	if minSize := (size + maxUploadParts - 1) / maxUploadParts; partSize < minSize {
+		partSize = minSize
+	}
+	return partSize
+}
+
+// upToDate compares a source object with the destination one of the same key.
+// Multipart ETags depend on the part size, so only the size and the time are compared for them.
+func upToDate(src, dst *s3.Object) bool {
+	if aws.Int64Value(src.Size) != aws.Int64Value(dst.Size) {
+		return false
+	}
+	srcETag, dstETag := aws.StringValue(src.ETag), aws.StringValue(dst.ETag)
+	if !isMultipartETag(srcETag) && !isMultipartETag(dstETag) {
+		return srcETag == dstETag
+	}
+	return !aws.TimeValue(dst.LastModified).Before(aws.TimeValue(src.LastModified))
+}
+
+// copySource is the URL-encoded source of CopyObject and UploadPartCopy
+func copySource(bucketName, key string) string {
+	return (&url.URL{Path: bucketName + "/" + key}).EscapedPath()
+}
+
+func isMultipartETag(eTag string) bool {
+	return strings.Contains(eTag, "-")
+}
+
+// keyLister iterates the objects of a bucket in key order
+type keyLister struct {
+	svc   *s3.S3
+	input *s3.ListObjectsV2Input
+	objs  []*s3.Object
+	done  bool
+}
+
+func newKeyLister(svc *s3.S3, bucketName string, prefix *string) *keyLister {
+	return &keyLister{
+		svc: svc,
+		input: &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucketName),
+			Prefix: prefix,
+		},
+	}
+}
+
+// next returns nil when all the objects have been returned
+func (l *keyLister) next(ctx context.Context) (*s3.Object, error) {
+	for len(l.objs) == 0 {
+		if l.done {
+			return nil, nil
+		}
+		output, err := l.svc.ListObjectsV2WithContext(ctx, l.input)
+		if err != nil {
+			return nil, err
+		}
+		l.objs = output.Contents
+		l.done = !aws.BoolValue(output.IsTruncated)
+		l.input.ContinuationToken = output.NextContinuationToken
+	}
+	obj := l.objs[0]
+	l.objs = l.objs[1:]
+	return obj, nil
+}
+
+// finish returns nil only if every object is in sync
+func (t *syncTask) finish() error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	errs := t.errors()
+	if failed := atomic.LoadUint64(&t.failed); failed > 0 {
+		errs = append(errs, fmt.Errorf("failed to sync %d objects from bucket %s to %s", failed, t.bucket, t.dstBucket))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,259 @@
+package s3box
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBucketSyncer_SyncWithContext(t *testing.T) {
+	svc := buildS3Client(t)
+	bs := NewBucketSyncer(svc, svc)
+
+	Convey("TestBucketSyncer_SyncWithContext", t, func() {
+		canceledCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		type args struct {
+			ctx           context.Context
+			srcBucket     string
+			dstBucket     string
+			syncWorkerNum int
+			opChanCap     int
+		}
+		tests := []struct {
+			name    string
+			args    args
+			want    error
+			wantErr bool
+		}{
+			{"SyncWithContext should success",
+				args{context.Background(), "abc", "abc-copy", 5, 1000},
+				nil,
+				false,
+			},
+			{"SyncWithContext should stop when canceled",
+				args{canceledCtx, "abc", "abc-copy", 5, 1000},
+				context.Canceled,
+				true,
+			},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := bs.SyncWithContext(tt.args.ctx, tt.args.srcBucket, tt.args.dstBucket, tt.args.syncWorkerNum, tt.args.opChanCap)
+				So(err, ShouldEqual, tt.want)
+				So(got, ShouldNotBeNil)
+				So(got.SrcBucket, ShouldEqual, tt.args.srcBucket)
+				So(got.Completed, ShouldEqual, !tt.wantErr)
+				So(got.Failed, ShouldEqual, 0)
+			})
+		}
+	})
+}
+
+// mockEndpoint serves unversioned buckets of objects by key, server side copies are denied if denyCopy is set
+type mockEndpoint struct {
+	mu       sync.Mutex
+	buckets  map[string]map[string]string
+	denyCopy bool
+}
+
+func (e *mockEndpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	path := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	objs := e.buckets[path[0]]
+	w.Header().Set("Content-Type", "application/xml")
+	switch {
+	case req.Method == "GET" && len(path) == 1:
+		keys := make([]string, 0, len(objs))
+		for key := range objs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprint(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`)
+		for _, key := range keys {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>%s</ETag><Size>%d</Size><LastModified>2024-01-01T00:00:00.000Z</LastModified></Contents>`,
+				key, mockETag(objs[key]), len(objs[key]))
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	case req.Method == "GET":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, objs[path[1]])
+	case req.Method == "PUT" && req.Header.Get("X-Amz-Copy-Source") != "":
+		if e.denyCopy {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>access denied</Message></Error>`)
+			return
+		}
+		source := strings.SplitN(strings.TrimPrefix(req.Header.Get("X-Amz-Copy-Source"), "/"), "/", 2)
+		objs[path[1]] = e.buckets[source[0]][source[1]]
+		fmt.Fprintf(w, `<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>`, mockETag(objs[path[1]]))
+	case req.Method == "PUT":
+		body, _ := io.ReadAll(req.Body)
+		objs[path[1]] = string(body)
+		w.Header().Set("ETag", mockETag(objs[path[1]]))
+	case req.Method == "DELETE":
+		delete(objs, path[1])
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func mockETag(content string) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum([]byte(content)))
+}
+
+func TestBucketSyncer_SyncWithMock(t *testing.T) {
+	Convey("TestBucketSyncer_SyncWithMock", t, func() {
+		endpoint := &mockEndpoint{
+			buckets: map[string]map[string]string{
+				"src": {"a": "1", "b": "2"},
+				"dst": {"b": "2", "c": "3"},
+			},
+		}
+		svc := buildMockS3Client(t, endpoint)
+		bs := NewBucketSyncer(svc, svc)
+		bs.Progress = NopProgressReporter{}
+		bs.RetryBackoff = time.Millisecond
+		bs.DeleteExtraneous = true
+
+		Convey("dry run should count the objects to be copied and deleted", func() {
+			bs.DryRun = true
+			got, err := bs.SyncWithContext(context.Background(), "src", "dst", 2, 10)
+			So(err, ShouldBeNil)
+			So(got.Completed, ShouldBeTrue)
+			So(got.Listed, ShouldEqual, 2)
+			So(got.UpToDate, ShouldEqual, 1)
+			So(got.Extraneous, ShouldEqual, 1)
+			So(got.Copied, ShouldEqual, 0)
+			So(got.Deleted, ShouldEqual, 0)
+			So(endpoint.buckets["dst"], ShouldResemble, map[string]string{"b": "2", "c": "3"})
+		})
+
+		Convey("denied server side copy should fall back to streaming", func() {
+			endpoint.denyCopy = true
+			got, err := bs.SyncWithContext(context.Background(), "src", "dst", 2, 10)
+			So(err, ShouldBeNil)
+			So(got.Completed, ShouldBeTrue)
+			So(got.Copied, ShouldEqual, 1)
+			So(got.Bytes, ShouldEqual, 1)
+			So(got.Extraneous, ShouldEqual, 1)
+			So(got.Deleted, ShouldEqual, 1)
+			So(got.Failed, ShouldEqual, 0)
+			So(endpoint.buckets["dst"], ShouldResemble, map[string]string{"a": "1", "b": "2"})
+		})
+
+		Convey("denied copy should fail in CopyServerSide mode", func() {
+			endpoint.denyCopy = true
+			bs.CopyMode = CopyServerSide
+			got, err := bs.SyncWithContext(context.Background(), "src", "dst", 2, 10)
+			So(err, ShouldNotBeNil)
+			So(got.Completed, ShouldBeFalse)
+			So(got.Failed, ShouldEqual, 1)
+			So(got.Errors, ShouldHaveLength, 1)
+			So(got.Errors[0].Code, ShouldEqual, "AccessDenied")
+		})
+
+		Convey("unsupported options should be rejected", func() {
+			bs.CheckpointFile = "sync.ckpt"
+			got, err := bs.SyncWithContext(context.Background(), "src", "dst", 2, 10)
+			So(err, ShouldNotBeNil)
+			So(got.Completed, ShouldBeFalse)
+		})
+	})
+}
+
+func TestBucketSyncer_partSize(t *testing.T) {
+	svc := buildS3Client(t)
+	bs := NewBucketSyncer(svc, svc)
+
+	Convey("TestBucketSyncer_partSize", t, func() {
+		tests := []struct {
+			name     string
+			partSize int64
+			size     int64
+			want     int64
+		}{
+			{"default part size should be used for small objects", defaultCopyPartSize, 1024, defaultCopyPartSize},
+			{"too small part size should be replaced", 1024, 1024, defaultCopyPartSize},
+			{"part size should be raised to fit 10000 parts", defaultCopyPartSize, 1 << 40, (1<<40 + maxUploadParts - 1) / maxUploadParts},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				bs.PartSize = tt.partSize
+				So(bs.partSize(tt.size), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
+
+func TestBucketSyncer_serverSide(t *testing.T) {
+	svc := buildS3Client(t)
+
+	Convey("TestBucketSyncer_serverSide", t, func() {
+		Convey("same endpoint should copy server side", func() {
+			So(NewBucketSyncer(svc, svc).serverSide(), ShouldBeTrue)
+		})
+
+		Convey("same endpoint with another access key should stream", func() {
+			other := s3.New(session.Must(session.NewSession(svc.Config.Copy(&aws.Config{
+				Credentials: credentials.NewStaticCredentials("ak2", "sk2", ""),
+			}))))
+			So(NewBucketSyncer(svc, other).serverSide(), ShouldBeFalse)
+		})
+
+		Convey("CopyStreaming should always stream", func() {
+			bs := NewBucketSyncer(svc, svc)
+			bs.CopyMode = CopyStreaming
+			So(bs.serverSide(), ShouldBeFalse)
+		})
+	})
+}
+
+func Test_upToDate(t *testing.T) {
+	now := time.Now()
+
+	Convey("Test_upToDate", t, func() {
+		obj := func(size int64, eTag string, modified time.Time) *s3.Object {
+			return &s3.Object{Size: aws.Int64(size), ETag: aws.String(eTag), LastModified: aws.Time(modified)}
+		}
+		tests := []struct {
+			name string
+			src  *s3.Object
+			dst  *s3.Object
+			want bool
+		}{
+			{"same size and ETag should be up to date",
+				obj(10, `"a"`, now), obj(10, `"a"`, now.Add(-time.Hour)), true},
+			{"different ETag should be copied",
+				obj(10, `"a"`, now), obj(10, `"b"`, now), false},
+			{"different size should be copied",
+				obj(10, `"a-2"`, now), obj(11, `"b"`, now), false},
+			{"multipart ETag with newer destination should be up to date",
+				obj(10, `"a-2"`, now), obj(10, `"b"`, now.Add(time.Hour)), true},
+			{"multipart ETag with older destination should be copied",
+				obj(10, `"a-2"`, now), obj(10, `"b-3"`, now.Add(-time.Hour)), false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(upToDate(tt.src, tt.dst), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
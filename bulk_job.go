@@ -0,0 +1,324 @@
+package s3box
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// BulkAction is the change a BulkJob applies to every matching object
+type BulkAction struct {
+	// Tags are merged into the tags of the object by PutObjectTagging, the values of existing keys are replaced
+	Tags map[string]string
+	// ReplaceTags makes Tags replace all the existing tags instead of being merged into them
+	ReplaceTags bool
+	// The non-empty headers below and Metadata are set by copying the object onto itself,
+	// the other headers, user metadata and the ACL are kept
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	ContentLanguage    string
+	// Metadata is merged into the user metadata of the object
+	Metadata map[string]string
+}
+
+func (a *BulkAction) rewritesMetadata() bool {
+	return a.ContentType != "" || a.CacheControl != "" || a.ContentDisposition != "" ||
+		a.ContentEncoding != "" || a.ContentLanguage != "" || len(a.Metadata) > 0
+}
+
+// BulkJob applies a BulkAction to the latest version of every object matching Filter.
+// It lists the bucket the same way as BucketCleaner, noncurrent versions and delete markers are skipped.
+// A metadata rewrite creates a new version on versioned buckets, and objects larger than 5GiB
+// can not be rewritten.
+type BulkJob struct {
+	svc *s3.S3
+
+	JobOptions
+
+	Action BulkAction
+}
+
+// BulkResult tells how far a BulkJob run got, it is partial when the run is canceled
+type BulkResult struct {
+	Bucket string
+	Listed uint64
+	// Skipped is the number of versions excluded by the filter, plus noncurrent versions and delete markers
+	Skipped uint64
+	// Bytes is the total size of listed objects
+	Bytes   uint64
+	Updated uint64
+	Failed  uint64
+	// Errors holds the per-key errors of updating objects,
+	// at most maxCleanErrors of them are kept while Failed always counts all the failures
+	Errors  []ObjectError
+	Elapsed time.Duration
+	// Completed is true only when the whole bucket has been walked without being canceled
+	Completed bool
+}
+
+func NewBulkJob(svc *s3.S3, action BulkAction) *BulkJob {
+	j := &BulkJob{
+		svc:        svc,
+		JobOptions: defaultJobOptions(),
+		Action:     action,
+	}
+	return j
+}
+
+// RunWithContext applies Action to the objects of the bucket with workerNum workers,
+// objChanCap is the capacity of the channel between the listers and the workers.
+// When ctx is canceled, the partial result is returned together with ctx.Err().
+// If CheckpointFile is set, the run resumes from the position saved by the previous unfinished run.
+func (j *BulkJob) RunWithContext(ctx context.Context, bucketName string, workerNum, objChanCap int) (*BulkResult, error) {
+	if len(j.Action.Tags) == 0 && !j.Action.rewritesMetadata() {
+		return &BulkResult{Bucket: bucketName}, errors.New("bulk action has nothing to change")
+	}
+
+	// every run lists with a cleaner of its own, so that concurrent runs do not share the options
+	cleaner := NewBucketCleaner(j.svc)
+	cleaner.JobOptions = j.JobOptions
+	source := cleanSource{
+		listObjs:  cleaner.listObjs,
+		resumable: true,
+	}
+	action := cleanAction{
+		prepare: func(task *cleanTask) {
+			task.latestOnly = true
+		},
+		work:   j.updateObjs,
+		finish: j.finishTask,
+	}
+
+	task, err := cleaner.runTask(ctx, bucketName, workerNum, objChanCap, source, action)
+	result := task.result()
+	return &BulkResult{
+		Bucket:    result.Bucket,
+		Listed:    result.Listed,
+		Skipped:   result.Skipped,
+		Bytes:     result.Bytes,
+		Updated:   atomic.LoadUint64(&task.updated),
+		Failed:    result.Failed,
+		Errors:    result.Errors,
+		Elapsed:   result.Elapsed,
+		Completed: err == nil,
+	}, err
+}
+
+// finishTask returns nil only if every listed object has been updated
+func (j *BulkJob) finishTask(task *cleanTask) error {
+	if err := task.ctx.Err(); err != nil {
+		return err
+	}
+	if j.Manifest != nil {
+		if err := j.Manifest.Flush(); err != nil {
+			task.addErr(fmt.Errorf("flush manifest: %w", err))
+		}
+	}
+
+	errs := task.errors()
+	if failed := atomic.LoadUint64(&task.failed); failed > 0 {
+		errs = append(errs, fmt.Errorf("failed to update %d objects of bucket %s", failed, task.bucket))
+	}
+	return errors.Join(errs...)
+}
+
+func (j *BulkJob) updateObjs(task *cleanTask, objChannel <-chan cleanObj) {
+	for {
+		select {
+		case <-task.ctx.Done():
+			return
+		case obj, ok := <-objChannel:
+			if !ok {
+				return
+			}
+			if !j.doUpdateReq(task, obj) {
+				return
+			}
+		}
+	}
+}
+
+// doUpdateReq updates an object with retries, it returns false if the task is canceled
+func (j *BulkJob) doUpdateReq(task *cleanTask, obj cleanObj) bool {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && !sleepBackoff(task.ctx, j.RetryBackoff, attempt) {
+			return false
+		}
+		if !task.wait(1) {
+			return false
+		}
+
+		err := j.update(task, aws.StringValue(obj.Key))
+		if task.ctx.Err() != nil {
+			return false
+		}
+		task.feedback(err)
+		if err != nil && isRetryableErr(err) && attempt < j.MaxRetries {
+			continue
+		}
+
+		if err != nil {
+			task.addVersionErr(obj.Key, obj.VersionId, err)
+			task.retryLater(obj)
+		} else {
+			atomic.AddUint64(&task.updated, 1)
+		}
+		task.done(obj)
+		return true
+	}
+}
+
+// update applies the action to the latest version of the key, the metadata is rewritten
+// before tagging since the copy keeps the tags of the source
+func (j *BulkJob) update(task *cleanTask, key string) error {
+	if j.Action.rewritesMetadata() {
+		if err := j.rewriteMetadata(task, key); err != nil {
+			return err
+		}
+	}
+	if len(j.Action.Tags) > 0 {
+		return j.putTags(task, key)
+	}
+	return nil
+}
+
+// rewriteMetadata copies the object onto itself with the new headers and metadata,
+// the grants of the object are sent with the copy since a copy gets the default ACL
+func (j *BulkJob) rewriteMetadata(task *cleanTask, key string) error {
+	svc := j.svc
+	head, err := svc.HeadObjectWithContext(task.ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(task.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	acl, err := svc.GetObjectAclWithContext(task.ctx, &s3.GetObjectAclInput{
+		Bucket:    aws.String(task.bucket),
+		Key:       aws.String(key),
+		VersionId: head.VersionId,
+	})
+	if err != nil {
+		return err
+	}
+
+	metadata := make(map[string]*string, len(head.Metadata)+len(j.Action.Metadata))
+	for k, v := range head.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range j.Action.Metadata {
+		metadata[k] = aws.String(v)
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:                  aws.String(task.bucket),
+		Key:                     aws.String(key),
+		CopySource:              aws.String(copySource(task.bucket, key)),
+		CopySourceIfMatch:       head.ETag,
+		MetadataDirective:       aws.String(s3.MetadataDirectiveReplace),
+		Metadata:                metadata,
+		ContentType:             orString(j.Action.ContentType, head.ContentType),
+		CacheControl:            orString(j.Action.CacheControl, head.CacheControl),
+		ContentDisposition:      orString(j.Action.ContentDisposition, head.ContentDisposition),
+		ContentEncoding:         orString(j.Action.ContentEncoding, head.ContentEncoding),
+		ContentLanguage:         orString(j.Action.ContentLanguage, head.ContentLanguage),
+		StorageClass:            head.StorageClass,
+		ServerSideEncryption:    head.ServerSideEncryption,
+		SSEKMSKeyId:             head.SSEKMSKeyId,
+		WebsiteRedirectLocation: head.WebsiteRedirectLocation,
+	}
+	setGrants(input, acl.Grants)
+	_, err = svc.CopyObjectWithContext(task.ctx, input)
+	return err
+}
+
+// setGrants sets the grant headers of a copy to the grants of an ACL
+func setGrants(input *s3.CopyObjectInput, grants []*s3.Grant) {
+	grantees := make(map[string][]string)
+	for _, grant := range grants {
+		if grant.Grantee == nil {
+			continue
+		}
+		var grantee string
+		switch aws.StringValue(grant.Grantee.Type) {
+		case s3.TypeCanonicalUser:
+			grantee = fmt.Sprintf("id=%q", aws.StringValue(grant.Grantee.ID))
+		case s3.TypeGroup:
+			grantee = fmt.Sprintf("uri=%q", aws.StringValue(grant.Grantee.URI))
+		case s3.TypeAmazonCustomerByEmail:
+			grantee = fmt.Sprintf("emailAddress=%q", aws.StringValue(grant.Grantee.EmailAddress))
+		default:
+			continue
+		}
+		permission := aws.StringValue(grant.Permission)
+		grantees[permission] = append(grantees[permission], grantee)
+	}
+
+	header := func(permission string) *string {
+		if len(grantees[permission]) == 0 {
+			return nil
+		}
+		return aws.String(strings.Join(grantees[permission], ", "))
+	}
+	input.GrantFullControl = header(s3.PermissionFullControl)
+	input.GrantRead = header(s3.PermissionRead)
+	input.GrantReadACP = header(s3.PermissionReadAcp)
+	input.GrantWriteACP = header(s3.PermissionWriteAcp)
+}
+
+// putTags merges Tags into the existing tags of the object unless ReplaceTags is set
+func (j *BulkJob) putTags(task *cleanTask, key string) error {
+	svc := j.svc
+	tags := make(map[string]string, len(j.Action.Tags))
+	if !j.Action.ReplaceTags {
+		output, err := svc.GetObjectTaggingWithContext(task.ctx, &s3.GetObjectTaggingInput{
+			Bucket: aws.String(task.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		for _, tag := range output.TagSet {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+	for k, v := range j.Action.Tags {
+		tags[k] = v
+	}
+
+	_, err := svc.PutObjectTaggingWithContext(task.ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(task.bucket),
+		Key:     aws.String(key),
+		Tagging: &s3.Tagging{TagSet: tagSet(tags)},
+	})
+	return err
+}
+
+// tagSet converts tags into a TagSet sorted by key
+func tagSet(tags map[string]string) []*s3.Tag {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	set := make([]*s3.Tag, 0, len(keys))
+	for _, k := range keys {
+		set = append(set, &s3.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+	return set
+}
+
+func orString(s string, fallback *string) *string {
+	if s != "" {
+		return aws.String(s)
+	}
+	return fallback
+}
@@ -0,0 +1,123 @@
+package s3box
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+)
+
+func TestBulkJob_RunWithContext(t *testing.T) {
+	svc := buildS3Client(t)
+
+	Convey("TestBulkJob_RunWithContext", t, func() {
+		canceledCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		type args struct {
+			ctx        context.Context
+			bucket     string
+			action     BulkAction
+			workerNum  int
+			objChanCap int
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"tagging should success",
+				args{context.Background(), "abc", BulkAction{Tags: map[string]string{"env": "test"}}, 5, 1000},
+				false,
+			},
+			{"metadata rewrite should success",
+				args{context.Background(), "abc", BulkAction{ContentType: "text/plain", CacheControl: "no-cache"}, 5, 1000},
+				false,
+			},
+			{"empty action should fail",
+				args{context.Background(), "abc", BulkAction{}, 5, 1000},
+				true,
+			},
+			{"RunWithContext should stop when canceled",
+				args{canceledCtx, "abc", BulkAction{Tags: map[string]string{"env": "test"}}, 5, 1000},
+				true,
+			},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				job := NewBulkJob(svc, tt.args.action)
+				got, err := job.RunWithContext(tt.args.ctx, tt.args.bucket, tt.args.workerNum, tt.args.objChanCap)
+				So(err != nil, ShouldEqual, tt.wantErr)
+				So(got, ShouldNotBeNil)
+				So(got.Bucket, ShouldEqual, tt.args.bucket)
+				So(got.Completed, ShouldEqual, !tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestBulkJob_concurrentRuns(t *testing.T) {
+	Convey("TestBulkJob_concurrentRuns", t, func() {
+		job := NewBulkJob(buildMockS3Client(t, newMockBucket("a", "b", "c")), BulkAction{Tags: map[string]string{"env": "test"}})
+		job.Progress = NopProgressReporter{}
+		job.DryRun = true
+
+		Convey("runs of the same job should not interfere with each other", func() {
+			results := make([]*BulkResult, 4)
+			errs := make([]error, len(results))
+			var wg sync.WaitGroup
+			for i := range results {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results[i], errs[i] = job.RunWithContext(context.Background(), "abc", 2, 10)
+				}()
+			}
+			wg.Wait()
+
+			for i, result := range results {
+				So(errs[i], ShouldBeNil)
+				So(result.Listed, ShouldEqual, 3)
+				So(result.Updated, ShouldEqual, 0)
+				So(result.Completed, ShouldBeTrue)
+			}
+		})
+	})
+}
+
+func Test_tagSet(t *testing.T) {
+	Convey("Test_tagSet", t, func() {
+		Convey("tags should be sorted by key", func() {
+			got := tagSet(map[string]string{"b": "2", "a": "1"})
+			So(got, ShouldResemble, []*s3.Tag{
+				{Key: aws.String("a"), Value: aws.String("1")},
+				{Key: aws.String("b"), Value: aws.String("2")},
+			})
+		})
+
+		Convey("empty tags should be an empty set", func() {
+			So(tagSet(nil), ShouldBeEmpty)
+		})
+	})
+}
+
+func Test_setGrants(t *testing.T) {
+	Convey("Test_setGrants", t, func() {
+		Convey("grants of the ACL should be sent by permission", func() {
+			input := &s3.CopyObjectInput{}
+			setGrants(input, []*s3.Grant{
+				{Grantee: &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("owner")}, Permission: aws.String(s3.PermissionFullControl)},
+				{Grantee: &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")}, Permission: aws.String(s3.PermissionRead)},
+				{Grantee: &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("reader")}, Permission: aws.String(s3.PermissionRead)},
+				{Grantee: &s3.Grantee{Type: aws.String(s3.TypeAmazonCustomerByEmail), EmailAddress: aws.String("a@b.c")}, Permission: aws.String(s3.PermissionReadAcp)},
+			})
+			So(aws.StringValue(input.GrantFullControl), ShouldEqual, `id="owner"`)
+			So(aws.StringValue(input.GrantRead), ShouldEqual, `uri="http://acs.amazonaws.com/groups/global/AllUsers", id="reader"`)
+			So(aws.StringValue(input.GrantReadACP), ShouldEqual, `emailAddress="a@b.c"`)
+			So(input.GrantWriteACP, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,201 @@
+package s3box
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Checkpoint is the content of a checkpoint file, it holds the position of every unfinished bucket
+type Checkpoint struct {
+	Buckets map[string]*BucketCheckpoint `json:"buckets"`
+}
+
+// BucketCheckpoint is the position of an unfinished EmptyBucket or BulkJob run.
+// The counts are cumulative over all the runs and may include versions after the markers,
+// because they are updated as soon as a version is handled while the markers only move
+// when every version before them has been handled.
+type BucketCheckpoint struct {
+	// Markers is keyed by the listing prefix, the marker of keys without ListDelimiter
+	// is keyed by the prefix and the delimiter joined with a NUL character
+	Markers map[string]ListMarker `json:"markers"`
+	DryRun  bool                  `json:"dry_run"`
+	Listed  uint64                `json:"listed"`
+	Skipped uint64                `json:"skipped"`
+	Bytes   uint64                `json:"bytes"`
+	Deleted uint64                `json:"deleted"`
+	Updated uint64                `json:"updated"`
+	Failed  uint64                `json:"failed"`
+	Aborted uint64                `json:"aborted"`
+	// Retries are the versions failed so far, the next run retries them before resuming the listing
+	Retries   []FailedVersion `json:"retries,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// FailedVersion is a version failed to be processed, which is behind the markers
+type FailedVersion struct {
+	Key       string `json:"key"`
+	VersionId string `json:"version_id,omitempty"`
+}
+
+// ListMarker is the position to resume ListObjectVersions from
+type ListMarker struct {
+	KeyMarker       string `json:"key_marker"`
+	VersionIdMarker string `json:"version_id_marker"`
+	// Done is true when the listing has reached the end
+	Done bool `json:"done"`
+}
+
+// ReadCheckpoint reads a checkpoint file, an empty Checkpoint is returned if the file does not exist
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	ckpt := &Checkpoint{
+		Buckets: make(map[string]*BucketCheckpoint),
+	}
+	buff, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ckpt, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(buff, ckpt)
+	if err != nil {
+		return nil, err
+	}
+	if ckpt.Buckets == nil {
+		ckpt.Buckets = make(map[string]*BucketCheckpoint)
+	}
+	return ckpt, nil
+}
+
+// WriteCheckpoint replaces the checkpoint file atomically
+func WriteCheckpoint(path string, ckpt *Checkpoint) error {
+	buff, err := json.MarshalIndent(ckpt, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(buff)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkpointStore shares a checkpoint file between the runs of a BucketCleaner
+type checkpointStore struct {
+	mu   sync.Mutex
+	path string
+	ckpt *Checkpoint
+}
+
+func newCheckpointStore(path string) (*checkpointStore, error) {
+	ckpt, err := ReadCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &checkpointStore{
+		path: path,
+		ckpt: ckpt,
+	}
+	return s, nil
+}
+
+func (s *checkpointStore) get(bucketName string) *BucketCheckpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ckpt.Buckets[bucketName]
+}
+
+// put saves the position of a bucket, the bucket is removed from the file when bucketCkpt is nil
+func (s *checkpointStore) put(bucketName string, bucketCkpt *BucketCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if bucketCkpt == nil {
+		delete(s.ckpt.Buckets, bucketName)
+	} else {
+		s.ckpt.Buckets[bucketName] = bucketCkpt
+	}
+	return WriteCheckpoint(s.path, s.ckpt)
+}
+
+// listTracker finds the position before which all the listed versions have been handled
+type listTracker struct {
+	mu     sync.Mutex
+	pages  []*listPage
+	marker ListMarker
+}
+
+// listPage is a page of ListObjectVersions whose versions are still being handled
+type listPage struct {
+	tracker *listTracker
+	// marker is the position after this page
+	marker ListMarker
+	// pending is the number of versions in handling, plus one held by the lister until the page is fully sent
+	pending int64
+}
+
+func newListTracker(marker ListMarker) *listTracker {
+	t := &listTracker{
+		marker: marker,
+	}
+	return t
+}
+
+func (t *listTracker) newPage(marker ListMarker) *listPage {
+	p := &listPage{
+		tracker: t,
+		marker:  marker,
+		pending: 1,
+	}
+	t.mu.Lock()
+	t.pages = append(t.pages, p)
+	t.mu.Unlock()
+	return p
+}
+
+func (t *listTracker) position() ListMarker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.marker
+}
+
+func (t *listTracker) advance() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.pages) > 0 && atomic.LoadInt64(&t.pages[0].pending) == 0 {
+		t.marker = t.pages[0].marker
+		t.pages = t.pages[1:]
+	}
+}
+
+func (p *listPage) add() {
+	if p != nil {
+		atomic.AddInt64(&p.pending, 1)
+	}
+}
+
+func (p *listPage) done() {
+	if p != nil && atomic.AddInt64(&p.pending, -1) == 0 {
+		p.tracker.advance()
+	}
+}
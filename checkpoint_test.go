@@ -0,0 +1,116 @@
+package s3box
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	Convey("TestCheckpoint", t, func() {
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		Convey("reading a missing file should return an empty checkpoint", func() {
+			got, err := ReadCheckpoint(path)
+			So(err, ShouldBeNil)
+			So(got.Buckets, ShouldBeEmpty)
+		})
+
+		Convey("checkpoint should be read back", func() {
+			ckpt := &Checkpoint{
+				Buckets: map[string]*BucketCheckpoint{
+					"abc": {
+						Markers:   map[string]ListMarker{"": {KeyMarker: "k", VersionIdMarker: "v"}},
+						Listed:    2000,
+						Deleted:   1000,
+						UpdatedAt: time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC),
+					},
+				},
+			}
+			So(WriteCheckpoint(path, ckpt), ShouldBeNil)
+
+			got, err := ReadCheckpoint(path)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, ckpt)
+		})
+	})
+}
+
+func TestListTracker(t *testing.T) {
+	Convey("TestListTracker", t, func() {
+		tracker := newListTracker(ListMarker{KeyMarker: "start"})
+		first := tracker.newPage(ListMarker{KeyMarker: "a"})
+		first.add()
+		first.done()
+		second := tracker.newPage(ListMarker{KeyMarker: "b", Done: true})
+		second.add()
+		second.done()
+
+		Convey("position should not move before the first page is handled", func() {
+			second.done()
+			So(tracker.position().KeyMarker, ShouldEqual, "start")
+		})
+
+		Convey("position should move over all the handled pages", func() {
+			second.done()
+			first.done()
+			So(tracker.position(), ShouldResemble, ListMarker{KeyMarker: "b", Done: true})
+		})
+	})
+}
+
+func TestBucketCleaner_resumeFailed(t *testing.T) {
+	Convey("TestBucketCleaner_resumeFailed", t, func() {
+		bucket := newMockBucket("a", "b", "c")
+		bucket.failures["b"] = &mockFailure{"AccessDenied", 1}
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		Convey("failed versions should be retried by the next run", func() {
+			c := buildMockCleaner(t, bucket)
+			c.CheckpointFile = path
+			got, err := c.EmptyBucketWithContext(context.Background(), "abc", 1, 10, true, false)
+			So(err, ShouldNotBeNil)
+			So(got.Deleted, ShouldEqual, 2)
+			So(got.Failed, ShouldEqual, 1)
+			ckpt, err := ReadCheckpoint(path)
+			So(err, ShouldBeNil)
+			So(ckpt.Buckets["abc"].Failed, ShouldEqual, 1)
+
+			So(ckpt.Buckets["abc"].Retries, ShouldResemble, []FailedVersion{{Key: "b", VersionId: "v1"}})
+			So(ckpt.Buckets["abc"].Markers[""].Done, ShouldBeTrue)
+
+			c = buildMockCleaner(t, bucket)
+			c.CheckpointFile = path
+			got, err = c.EmptyBucketWithContext(context.Background(), "abc", 1, 10, true, false)
+			So(err, ShouldBeNil)
+			So(got.Completed, ShouldBeTrue)
+			So(got.Listed, ShouldEqual, 3)
+			So(got.Deleted, ShouldEqual, 3)
+			So(got.Failed, ShouldEqual, 0)
+			So(bucket.remaining(), ShouldBeEmpty)
+			So(bucket.lists, ShouldEqual, 1)
+			ckpt, err = ReadCheckpoint(path)
+			So(err, ShouldBeNil)
+			So(ckpt.Buckets, ShouldBeEmpty)
+		})
+
+		Convey("permanently failed versions should not make the next run list again", func() {
+			bucket.failures["b"].times = -1
+			for i := 0; i < 2; i++ {
+				c := buildMockCleaner(t, bucket)
+				c.CheckpointFile = path
+				got, err := c.EmptyBucketWithContext(context.Background(), "abc", 1, 10, true, false)
+				So(err, ShouldNotBeNil)
+				So(got.Failed, ShouldEqual, 1)
+				So(got.Deleted, ShouldEqual, 2)
+			}
+			So(bucket.lists, ShouldEqual, 1)
+			So(bucket.remaining(), ShouldResemble, []string{"b"})
+			ckpt, err := ReadCheckpoint(path)
+			So(err, ShouldBeNil)
+			So(ckpt.Buckets["abc"].Retries, ShouldResemble, []FailedVersion{{Key: "b", VersionId: "v1"}})
+		})
+	})
+}
@@ -0,0 +1,213 @@
+package s3box
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"path"
+	"regexp"
+	"sync"
+)
+
+// BucketSelector picks buckets by name. A bucket is selected if it matches any of the include patterns,
+// or there are none of them, and it matches none of the exclude patterns and protected buckets.
+type BucketSelector struct {
+	// Include and Exclude are glob patterns in the syntax of path.Match
+	Include       []string
+	Exclude       []string
+	IncludeRegexp []*regexp.Regexp
+	ExcludeRegexp []*regexp.Regexp
+	// Protected are the names or glob patterns of buckets which are never deleted
+	Protected []string
+}
+
+// Match reports whether the bucket is selected, the reason is given when it is not
+func (s *BucketSelector) Match(bucketName string) (bool, string) {
+	if p, ok := matchGlob(s.Protected, bucketName); ok {
+		return false, fmt.Sprintf("protected by %q", p)
+	}
+	if p, ok := matchGlob(s.Exclude, bucketName); ok {
+		return false, fmt.Sprintf("excluded by %q", p)
+	}
+	if re, ok := matchRegexp(s.ExcludeRegexp, bucketName); ok {
+		return false, fmt.Sprintf("excluded by %q", re)
+	}
+
+	if len(s.Include) == 0 && len(s.IncludeRegexp) == 0 {
+		return true, ""
+	}
+	if _, ok := matchGlob(s.Include, bucketName); ok {
+		return true, ""
+	}
+	if _, ok := matchRegexp(s.IncludeRegexp, bucketName); ok {
+		return true, ""
+	}
+	return false, "not included"
+}
+
+// Validate checks the syntax of the glob patterns
+func (s *BucketSelector) Validate() error {
+	for _, patterns := range [][]string{s.Include, s.Exclude, s.Protected} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+func matchGlob(patterns []string, name string) (string, bool) {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func matchRegexp(res []*regexp.Regexp, name string) (string, bool) {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return re.String(), true
+		}
+	}
+	return "", false
+}
+
+// DeleteBucketsOptions controls DeleteBucketsWithContext, zero numbers are replaced by the defaults.
+// Note that the zero value of MultiDel deletes a version per request, see DefaultDeleteBucketsOptions.
+type DeleteBucketsOptions struct {
+	Selector BucketSelector
+	// Confirm is called before cleaning every selected bucket, which is skipped if it returns false.
+	// It is called from a single goroutine even when BucketConcurrency is greater than 1.
+	Confirm func(bucketName string) bool
+	// DeleteWorkerNum is the number of delete workers of every bucket, 3 by default
+	DeleteWorkerNum int
+	// ObjChanCap is the capacity of the channel of every bucket, 1000 by default
+	ObjChanCap int
+	MultiDel   bool
+	// KeepBuckets empties the buckets without deleting them
+	KeepBuckets bool
+	// BucketConcurrency is the number of buckets cleaned at the same time, 1 by default
+	BucketConcurrency int
+}
+
+// DefaultDeleteBucketsOptions returns the options DeleteAllBuckets used to hardcode
+func DefaultDeleteBucketsOptions() *DeleteBucketsOptions {
+	opts := &DeleteBucketsOptions{
+		DeleteWorkerNum:   3,
+		ObjChanCap:        1000,
+		MultiDel:          true,
+		BucketConcurrency: 1,
+	}
+	return opts
+}
+
+// numbers returns DeleteWorkerNum, ObjChanCap and BucketConcurrency with the zero ones replaced by the defaults
+func (o *DeleteBucketsOptions) numbers() (int, int, int) {
+	deleteWorkerNum := o.DeleteWorkerNum
+	if deleteWorkerNum <= 0 {
+		deleteWorkerNum = 3
+	}
+	objChanCap := o.ObjChanCap
+	if objChanCap <= 0 {
+		objChanCap = 1000
+	}
+	bucketConcurrency := o.BucketConcurrency
+	if bucketConcurrency <= 0 {
+		bucketConcurrency = 1
+	}
+	return deleteWorkerNum, objChanCap, bucketConcurrency
+}
+
+// BucketReport is the summary of a bucket handled by DeleteBucketsWithContext
+type BucketReport struct {
+	Bucket string
+	// SkipReason is set when the bucket is not selected or not confirmed, Result is nil in that case
+	SkipReason string
+	Result     *CleanResult
+	Err        error
+}
+
+// DeleteBucketsResult holds the reports of all the buckets of the user in the order of ListBuckets
+type DeleteBucketsResult struct {
+	Reports   []BucketReport
+	Succeeded int
+	Failed    int
+	Skipped   int
+}
+
+// DeleteBucketsWithContext empties and deletes the buckets of the user picked by opts.Selector.
+// A non-nil error is returned if any selected bucket failed, the details are in the reports.
+// Progress reporters may be called concurrently when opts.BucketConcurrency is greater than 1.
+func (c *BucketCleaner) DeleteBucketsWithContext(ctx context.Context, opts *DeleteBucketsOptions) (*DeleteBucketsResult, error) {
+	if opts == nil {
+		opts = DefaultDeleteBucketsOptions()
+	}
+	if err := opts.Selector.Validate(); err != nil {
+		return nil, err
+	}
+	deleteWorkerNum, objChanCap, bucketConcurrency := opts.numbers()
+
+	listBucketsOutput, err := c.svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeleteBucketsResult{
+		Reports: make([]BucketReport, len(listBucketsOutput.Buckets)),
+	}
+	sem := make(chan struct{}, bucketConcurrency)
+	var wg sync.WaitGroup
+	for i, b := range listBucketsOutput.Buckets {
+		report := &result.Reports[i]
+		report.Bucket = aws.StringValue(b.Name)
+
+		if ok, reason := opts.Selector.Match(report.Bucket); !ok {
+			report.SkipReason = reason
+			continue
+		}
+		if ctx.Err() != nil {
+			report.SkipReason = "canceled"
+			continue
+		}
+		if opts.Confirm != nil && !opts.Confirm(report.Bucket) {
+			report.SkipReason = "not confirmed"
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			report.SkipReason = "canceled"
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			report.Result, report.Err = c.EmptyBucketWithContext(ctx, report.Bucket, deleteWorkerNum, objChanCap, opts.MultiDel, !opts.KeepBuckets)
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, report := range result.Reports {
+		switch {
+		case report.SkipReason != "":
+			result.Skipped++
+		case report.Err != nil:
+			result.Failed++
+			errs = append(errs, fmt.Errorf("bucket %s: %w", report.Bucket, report.Err))
+		default:
+			result.Succeeded++
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, errors.Join(errs...)
+}
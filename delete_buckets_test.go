@@ -0,0 +1,69 @@
+package s3box
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
+	"testing"
+)
+
+func TestBucketSelector_Match(t *testing.T) {
+	Convey("TestBucketSelector_Match", t, func() {
+		selector := BucketSelector{
+			Include:       []string{"test-*"},
+			IncludeRegexp: []*regexp.Regexp{regexp.MustCompile(`^ci-\d+$`)},
+			Exclude:       []string{"test-keep-*"},
+			Protected:     []string{"test-prod"},
+		}
+		tests := []struct {
+			name   string
+			bucket string
+			want   bool
+		}{
+			{"included by glob", "test-abc", true},
+			{"included by regexp", "ci-123", true},
+			{"not included", "abc", false},
+			{"excluded", "test-keep-1", false},
+			{"protected", "test-prod", false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, reason := selector.Match(tt.bucket)
+				So(got, ShouldEqual, tt.want)
+				So(reason == "", ShouldEqual, tt.want)
+			})
+		}
+
+		Convey("empty selector should match everything", func() {
+			got, _ := (&BucketSelector{}).Match("abc")
+			So(got, ShouldBeTrue)
+		})
+
+		Convey("invalid pattern should be reported", func() {
+			So((&BucketSelector{Include: []string{"["}}).Validate(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBucketCleaner_DeleteBucketsWithContext(t *testing.T) {
+	svc := buildS3Client(t)
+	bc := NewBucketCleaner(svc)
+
+	Convey("TestBucketCleaner_DeleteBucketsWithContext", t, func() {
+		opts := DefaultDeleteBucketsOptions()
+		opts.Selector.Include = []string{"abc*"}
+		opts.Selector.Protected = []string{"abc-prod"}
+		opts.Confirm = func(bucketName string) bool {
+			return true
+		}
+		opts.BucketConcurrency = 2
+
+		Convey("DeleteBucketsWithContext should success", func() {
+			got, err := bc.DeleteBucketsWithContext(context.Background(), opts)
+			So(err, ShouldBeNil)
+			So(got, ShouldNotBeNil)
+			So(got.Failed, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,199 @@
+package s3box
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"sync"
+	"time"
+)
+
+// FleetTarget is a bucket to be emptied with the credentials of its owner
+type FleetTarget struct {
+	// Owner names the target in the report, such as the uid of the bucket owner
+	Owner string
+	// Credentials are the credentials of the owner, the ones of the FleetCleaner config are used if it is nil
+	Credentials *credentials.Credentials
+	Bucket      string
+}
+
+// FleetCleaner empties the buckets of many owners at once under a single concurrency and rate budget
+type FleetCleaner struct {
+	sess *session.Session
+
+	// JobOptions are applied to every bucket. RequestsPerSecond and ObjectsPerSecond are shared by all the buckets,
+	// so are Progress, Manifest and CheckpointFile.
+	JobOptions
+
+	// Configure is called with the cleaner of every bucket before it starts, to set the other options of BucketCleaner
+	Configure func(c *BucketCleaner)
+}
+
+// FleetReport is the consolidated report of a FleetCleaner run, the targets are in the order they are given
+type FleetReport struct {
+	StartedAt time.Time
+	Elapsed   time.Duration
+	Targets   []FleetTargetReport
+	Succeeded int
+	Failed    int
+	Skipped   int
+	// Deleted, Aborted and Bytes are the totals of all the targets
+	Deleted uint64
+	Aborted uint64
+	Bytes   uint64
+}
+
+// FleetTargetReport is the summary of a target
+type FleetTargetReport struct {
+	Owner  string
+	Bucket string
+	// SkipReason is set when the bucket is not selected or not confirmed, Result is nil in that case
+	SkipReason string       `json:",omitempty"`
+	Result     *CleanResult `json:",omitempty"`
+	Err        error        `json:"-"`
+	// Error is the message of Err
+	Error string `json:",omitempty"`
+}
+
+// NewFleetCleaner returns a FleetCleaner whose clients are made from conf, an error is returned if conf is not usable
+func NewFleetCleaner(conf *aws.Config) (*FleetCleaner, error) {
+	if conf == nil {
+		return nil, errors.New("aws config of FleetCleaner is nil")
+	}
+	sess, err := session.NewSession(conf)
+	if err != nil {
+		return nil, err
+	}
+	f := &FleetCleaner{
+		sess:       sess,
+		JobOptions: defaultJobOptions(),
+	}
+	return f, nil
+}
+
+// CleanWithContext empties the targets, and deletes them unless opts.KeepBuckets is set.
+// opts.Selector and opts.Confirm pick the targets by bucket name, and opts.BucketConcurrency is the number of
+// buckets emptied at the same time across all the owners. ListBuckets is never called.
+// A non-nil error is returned if any selected target failed, the details are in the report.
+func (f *FleetCleaner) CleanWithContext(ctx context.Context, targets []FleetTarget, opts *DeleteBucketsOptions) (*FleetReport, error) {
+	if opts == nil {
+		opts = DefaultDeleteBucketsOptions()
+	}
+	if err := opts.Selector.Validate(); err != nil {
+		return nil, err
+	}
+	deleteWorkerNum, objChanCap, bucketConcurrency := opts.numbers()
+
+	var reqLimiter, objLimiter *RateLimiter
+	if f.RequestsPerSecond > 0 || f.AdaptiveRate {
+		reqLimiter = NewRateLimiter(f.RequestsPerSecond)
+	}
+	if f.ObjectsPerSecond > 0 {
+		objLimiter = NewRateLimiter(f.ObjectsPerSecond)
+	}
+	var store *checkpointStore
+	if f.CheckpointFile != "" {
+		var err error
+		if store, err = newCheckpointStore(f.CheckpointFile); err != nil {
+			return nil, fmt.Errorf("read checkpoint: %w", err)
+		}
+	}
+
+	report := &FleetReport{
+		StartedAt: time.Now(),
+		Targets:   make([]FleetTargetReport, len(targets)),
+	}
+	clients := make(map[*credentials.Credentials]*s3.S3)
+	sem := make(chan struct{}, bucketConcurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		targetReport := &report.Targets[i]
+		targetReport.Owner = target.Owner
+		targetReport.Bucket = target.Bucket
+
+		if ok, reason := opts.Selector.Match(target.Bucket); !ok {
+			targetReport.SkipReason = reason
+			continue
+		}
+		if ctx.Err() != nil {
+			targetReport.SkipReason = "canceled"
+			continue
+		}
+		if opts.Confirm != nil && !opts.Confirm(target.Bucket) {
+			targetReport.SkipReason = "not confirmed"
+			continue
+		}
+
+		svc, ok := clients[target.Credentials]
+		if !ok {
+			svc = f.newClient(target.Credentials)
+			clients[target.Credentials] = svc
+		}
+		cleaner := NewBucketCleaner(svc)
+		cleaner.JobOptions = f.JobOptions
+		cleaner.reqLimiter, cleaner.objLimiter = reqLimiter, objLimiter
+		cleaner.ckptStore = store
+		if f.Configure != nil {
+			f.Configure(cleaner)
+		}
+
+		select {
+		case <-ctx.Done():
+			targetReport.SkipReason = "canceled"
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			targetReport.Result, targetReport.Err = cleaner.EmptyBucketWithContext(ctx, target.Bucket, deleteWorkerNum, objChanCap, opts.MultiDel, !opts.KeepBuckets)
+		}()
+	}
+	wg.Wait()
+	report.Elapsed = time.Since(report.StartedAt)
+
+	var errs []error
+	for i := range report.Targets {
+		targetReport := &report.Targets[i]
+		if result := targetReport.Result; result != nil {
+			report.Deleted += result.Deleted
+			report.Aborted += result.Aborted
+			report.Bytes += result.Bytes
+		}
+		switch {
+		case targetReport.SkipReason != "":
+			report.Skipped++
+		case targetReport.Err != nil:
+			targetReport.Error = targetReport.Err.Error()
+			report.Failed++
+			errs = append(errs, fmt.Errorf("bucket %s of %s: %w", targetReport.Bucket, targetReport.Owner, targetReport.Err))
+		default:
+			report.Succeeded++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	return report, errors.Join(errs...)
+}
+
+func (f *FleetCleaner) newClient(creds *credentials.Credentials) *s3.S3 {
+	if creds == nil {
+		return s3.New(f.sess)
+	}
+	return s3.New(f.sess.Copy(&aws.Config{Credentials: creds}))
+}
+
+// WriteJSON writes the report as an indented JSON object
+func (r *FleetReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
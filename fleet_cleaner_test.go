@@ -0,0 +1,87 @@
+package s3box
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func buildFleetCleaner(t *testing.T) *FleetCleaner {
+	t.Helper()
+	conf := &aws.Config{
+		Endpoint:         aws.String("http://endpoint/"),
+		Region:           aws.String("mock-region"),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("ak", "sk", ""),
+	}
+	fc, err := NewFleetCleaner(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func TestNewFleetCleaner(t *testing.T) {
+	Convey("TestNewFleetCleaner", t, func() {
+		Convey("nil config should be rejected", func() {
+			fc, err := NewFleetCleaner(nil)
+			So(err, ShouldNotBeNil)
+			So(fc, ShouldBeNil)
+		})
+
+		Convey("clients should use the credentials of the target or the config", func() {
+			fc := buildFleetCleaner(t)
+			creds := credentials.NewStaticCredentials("ak1", "sk1", "")
+			So(fc.newClient(creds).Config.Credentials, ShouldEqual, creds)
+			value, err := fc.newClient(nil).Config.Credentials.Get()
+			So(err, ShouldBeNil)
+			So(value.AccessKeyID, ShouldEqual, "ak")
+		})
+	})
+}
+
+func TestFleetCleaner_CleanWithContext(t *testing.T) {
+	fc := buildFleetCleaner(t)
+	fc.Progress = NopProgressReporter{}
+	fc.RequestsPerSecond = 100
+
+	Convey("TestFleetCleaner_CleanWithContext", t, func() {
+		targets := []FleetTarget{
+			{Owner: "user1", Credentials: credentials.NewStaticCredentials("ak1", "sk1", ""), Bucket: "abc"},
+			{Owner: "user2", Credentials: credentials.NewStaticCredentials("ak2", "sk2", ""), Bucket: "abc-2"},
+			{Owner: "user2", Bucket: "prod-data"},
+		}
+		opts := DefaultDeleteBucketsOptions()
+		opts.Selector.Protected = []string{"prod-*"}
+		opts.BucketConcurrency = 2
+
+		Convey("CleanWithContext should success", func() {
+			got, err := fc.CleanWithContext(context.Background(), targets, opts)
+			So(err, ShouldBeNil)
+			So(got.Succeeded, ShouldEqual, 2)
+			So(got.Skipped, ShouldEqual, 1)
+		})
+
+		Convey("CleanWithContext should skip every target when canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			got, err := fc.CleanWithContext(ctx, targets, opts)
+			So(err, ShouldEqual, context.Canceled)
+			So(got.Targets, ShouldHaveLength, len(targets))
+			So(got.Skipped, ShouldEqual, len(targets))
+			So(got.Targets[0].SkipReason, ShouldEqual, "canceled")
+			So(got.Targets[2].SkipReason, ShouldContainSubstring, "protected")
+
+			var buf bytes.Buffer
+			So(got.WriteJSON(&buf), ShouldBeNil)
+			var decoded FleetReport
+			So(json.Unmarshal(buf.Bytes(), &decoded), ShouldBeNil)
+			So(decoded.Targets[1].Owner, ShouldEqual, "user2")
+		})
+	})
+}
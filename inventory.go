@@ -0,0 +1,310 @@
+package s3box
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTopPrefixes = 10
+
+// sizeBounds are the exclusive upper bounds of the size histogram, the bound of the last bucket is not checked
+var sizeBounds = []struct {
+	label string
+	bound int64
+}{
+	{"<1KiB", 1 << 10},
+	{"<64KiB", 64 << 10},
+	{"<1MiB", 1 << 20},
+	{"<16MiB", 16 << 20},
+	{"<128MiB", 128 << 20},
+	{"<1GiB", 1 << 30},
+	{"<5GiB", 5 << 30},
+	{">=5GiB", math.MaxInt64},
+}
+
+// BucketInventory walks a bucket with ListObjectVersions and ListMultipartUploads and sums up what is in it.
+// With the same Filter, the report tells what EmptyBucket would remove.
+type BucketInventory struct {
+	svc *s3.S3
+
+	// Filter selects the versions, delete markers and multipart uploads to be counted, all of them are counted when it is nil
+	Filter *ObjectFilter
+	// TopPrefixes is the number of the largest prefixes in the report, 10 by default
+	TopPrefixes int
+	// PrefixDelimiter and PrefixDepth decide the prefix of a key, which ends at the PrefixDepth-th delimiter.
+	// They are "/" and 1 by default, keys with fewer delimiters end at the last one,
+	// and keys without the delimiter are counted under the empty prefix.
+	PrefixDelimiter string
+	PrefixDepth     int
+}
+
+// InventoryReport is the content of a bucket, sizes are in bytes
+type InventoryReport struct {
+	Bucket      string    `json:"bucket"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// Objects is the number of latest versions, which are not delete markers
+	Objects     uint64 `json:"objects"`
+	ObjectBytes uint64 `json:"object_bytes"`
+	// Versions counts all the versions including the latest ones
+	Versions           uint64 `json:"versions"`
+	Bytes              uint64 `json:"bytes"`
+	NoncurrentVersions uint64 `json:"noncurrent_versions"`
+	NoncurrentBytes    uint64 `json:"noncurrent_bytes"`
+	DeleteMarkers      uint64 `json:"delete_markers"`
+	// MultipartUploads are the uploads neither completed nor aborted, their bytes are the sizes of uploaded parts
+	MultipartUploads uint64 `json:"multipart_uploads"`
+	MultipartBytes   uint64 `json:"multipart_bytes"`
+	// Skipped is the number of versions, delete markers and multipart uploads excluded by the filter
+	Skipped        uint64          `json:"skipped"`
+	SizeHistogram  []InventoryStat `json:"size_histogram"`
+	StorageClasses []InventoryStat `json:"storage_classes"`
+	TopPrefixes    []InventoryStat `json:"top_prefixes"`
+}
+
+// InventoryStat is the number and total size of the versions in a group, such as a storage class
+type InventoryStat struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
+func NewBucketInventory(svc *s3.S3) *BucketInventory {
+	i := &BucketInventory{
+		svc:             svc,
+		TopPrefixes:     defaultTopPrefixes,
+		PrefixDelimiter: "/",
+		PrefixDepth:     1,
+	}
+	return i
+}
+
+// ReportWithContext walks the whole bucket, it returns the report only if every listing succeeds
+func (i *BucketInventory) ReportWithContext(ctx context.Context, bucketName string) (*InventoryReport, error) {
+	b := newInventoryBuilder(bucketName, i.PrefixDelimiter, i.PrefixDepth)
+	if err := i.listVersions(ctx, b); err != nil {
+		return nil, fmt.Errorf("list object versions of bucket %s: %w", bucketName, err)
+	}
+	if err := i.listUploads(ctx, b); err != nil {
+		return nil, fmt.Errorf("list multipart uploads of bucket %s: %w", bucketName, err)
+	}
+
+	topPrefixes := i.TopPrefixes
+	if topPrefixes <= 0 {
+		topPrefixes = defaultTopPrefixes
+	}
+	return b.build(topPrefixes), nil
+}
+
+func (i *BucketInventory) listVersions(ctx context.Context, b *inventoryBuilder) error {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.report.Bucket),
+		Prefix: i.Filter.prefix(),
+	}
+	for {
+		output, err := i.svc.ListObjectVersionsWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, v := range output.Versions {
+			matched := i.Filter.matchVersion(v)
+			if matched {
+				if matched, err = i.Filter.matchTags(ctx, i.svc, b.report.Bucket, v); err != nil {
+					return err
+				}
+			}
+			if !matched {
+				b.report.Skipped++
+				continue
+			}
+			b.addVersion(v)
+		}
+		for _, m := range output.DeleteMarkers {
+			if !i.Filter.matchDeleteMarker(m) {
+				b.report.Skipped++
+				continue
+			}
+			b.report.DeleteMarkers++
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.VersionIdMarker = output.NextVersionIdMarker
+	}
+}
+
+func (i *BucketInventory) listUploads(ctx context.Context, b *inventoryBuilder) error {
+	var partsErr error
+	err := listUploads(ctx, i.svc, b.report.Bucket, i.Filter.prefix(), func(upload *s3.MultipartUpload) bool {
+		if !i.Filter.matchUpload(upload) {
+			b.report.Skipped++
+			return true
+		}
+		var size int64
+		size, partsErr = uploadPartsSize(ctx, i.svc, nil, b.report.Bucket, upload.Key, upload.UploadId)
+		if partsErr != nil {
+			return false
+		}
+		b.report.MultipartUploads++
+		b.report.MultipartBytes += uint64(size)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return partsErr
+}
+
+// inventoryBuilder sums up the listed versions into a report
+type inventoryBuilder struct {
+	report    *InventoryReport
+	delimiter string
+	depth     int
+	histogram []InventoryStat
+	classes   map[string]*InventoryStat
+	prefixes  map[string]*InventoryStat
+}
+
+func newInventoryBuilder(bucketName, delimiter string, depth int) *inventoryBuilder {
+	b := &inventoryBuilder{
+		report:    &InventoryReport{Bucket: bucketName},
+		delimiter: delimiter,
+		depth:     depth,
+		histogram: make([]InventoryStat, len(sizeBounds)),
+		classes:   make(map[string]*InventoryStat),
+		prefixes:  make(map[string]*InventoryStat),
+	}
+	for idx, bound := range sizeBounds {
+		b.histogram[idx].Name = bound.label
+	}
+	return b
+}
+
+func (b *inventoryBuilder) addVersion(v *s3.ObjectVersion) {
+	size := aws.Int64Value(v.Size)
+	r := b.report
+	r.Versions++
+	r.Bytes += uint64(size)
+	if aws.BoolValue(v.IsLatest) {
+		r.Objects++
+		r.ObjectBytes += uint64(size)
+	} else {
+		r.NoncurrentVersions++
+		r.NoncurrentBytes += uint64(size)
+	}
+
+	idx := sort.Search(len(sizeBounds)-1, func(i int) bool { return size < sizeBounds[i].bound })
+	addStat(&b.histogram[idx], size)
+
+	class := aws.StringValue(v.StorageClass)
+	if class == "" {
+		class = s3.StorageClassStandard
+	}
+	addStat(statOf(b.classes, class), size)
+	addStat(statOf(b.prefixes, b.prefix(aws.StringValue(v.Key))), size)
+}
+
+// prefix returns the key up to its depth-th delimiter
+func (b *inventoryBuilder) prefix(key string) string {
+	if b.delimiter == "" {
+		return ""
+	}
+	end := 0
+	for n := 0; n < b.depth; n++ {
+		idx := strings.Index(key[end:], b.delimiter)
+		if idx < 0 {
+			break
+		}
+		end += idx + len(b.delimiter)
+	}
+	return key[:end]
+}
+
+func (b *inventoryBuilder) build(topPrefixes int) *InventoryReport {
+	r := b.report
+	r.GeneratedAt = time.Now()
+	r.SizeHistogram = b.histogram
+	r.StorageClasses = sortStats(b.classes, func(x, y InventoryStat) bool { return x.Name < y.Name })
+	r.TopPrefixes = sortStats(b.prefixes, func(x, y InventoryStat) bool {
+		if x.Bytes != y.Bytes {
+			return x.Bytes > y.Bytes
+		}
+		return x.Name < y.Name
+	})
+	if len(r.TopPrefixes) > topPrefixes {
+		r.TopPrefixes = r.TopPrefixes[:topPrefixes]
+	}
+	return r
+}
+
+func statOf(stats map[string]*InventoryStat, name string) *InventoryStat {
+	stat, ok := stats[name]
+	if !ok {
+		stat = &InventoryStat{Name: name}
+		stats[name] = stat
+	}
+	return stat
+}
+
+func addStat(stat *InventoryStat, size int64) {
+	stat.Count++
+	stat.Bytes += uint64(size)
+}
+
+func sortStats(stats map[string]*InventoryStat, less func(a, b InventoryStat) bool) []InventoryStat {
+	sorted := make([]InventoryStat, 0, len(stats))
+	for _, stat := range stats {
+		sorted = append(sorted, *stat)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// WriteJSON writes the report as an indented JSON object
+func (r *InventoryReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the report as records of section, name, count and bytes
+func (r *InventoryReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{
+		{"section", "name", "count", "bytes"},
+		{"summary", "objects", formatUint(r.Objects), formatUint(r.ObjectBytes)},
+		{"summary", "versions", formatUint(r.Versions), formatUint(r.Bytes)},
+		{"summary", "noncurrent_versions", formatUint(r.NoncurrentVersions), formatUint(r.NoncurrentBytes)},
+		{"summary", "delete_markers", formatUint(r.DeleteMarkers), "0"},
+		{"summary", "multipart_uploads", formatUint(r.MultipartUploads), formatUint(r.MultipartBytes)},
+		{"summary", "skipped", formatUint(r.Skipped), ""},
+	}
+	for _, section := range []struct {
+		name  string
+		stats []InventoryStat
+	}{
+		{"size", r.SizeHistogram},
+		{"storage_class", r.StorageClasses},
+		{"prefix", r.TopPrefixes},
+	} {
+		for _, stat := range section.stats {
+			records = append(records, []string{section.name, stat.Name, formatUint(stat.Count), formatUint(stat.Bytes)})
+		}
+	}
+	return cw.WriteAll(records)
+}
+
+func formatUint(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
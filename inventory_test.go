@@ -0,0 +1,121 @@
+package s3box
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestBucketInventory_ReportWithContext(t *testing.T) {
+	svc := buildS3Client(t)
+	inv := NewBucketInventory(svc)
+
+	Convey("TestBucketInventory_ReportWithContext", t, func() {
+		tests := []struct {
+			name    string
+			bucket  string
+			wantErr bool
+		}{
+			{"ReportWithContext should success",
+				"abc",
+				false,
+			},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := inv.ReportWithContext(context.Background(), tt.bucket)
+				So(err, ShouldBeNil)
+				So(got.Bucket, ShouldEqual, tt.bucket)
+			})
+		}
+	})
+}
+
+func Test_inventoryBuilder(t *testing.T) {
+	Convey("Test_inventoryBuilder", t, func() {
+		version := func(key string, size int64, latest bool, class string) *s3.ObjectVersion {
+			v := &s3.ObjectVersion{Key: aws.String(key), Size: aws.Int64(size), IsLatest: aws.Bool(latest)}
+			if class != "" {
+				v.StorageClass = aws.String(class)
+			}
+			return v
+		}
+		b := newInventoryBuilder("abc", "/", 1)
+		b.addVersion(version("logs/1.txt", 100, true, ""))
+		b.addVersion(version("logs/1.txt", 200, false, ""))
+		b.addVersion(version("data/a/b.bin", 2<<20, true, s3.StorageClassStandardIa))
+		b.addVersion(version("root.txt", 6<<30, true, ""))
+		report := b.build(2)
+
+		Convey("versions should be counted as objects or noncurrent versions", func() {
+			So(report.Objects, ShouldEqual, 3)
+			So(report.Versions, ShouldEqual, 4)
+			So(report.NoncurrentVersions, ShouldEqual, 1)
+			So(report.NoncurrentBytes, ShouldEqual, 200)
+			So(report.Bytes, ShouldEqual, 300+2<<20+6<<30)
+		})
+
+		Convey("sizes should fall into the histogram", func() {
+			So(report.SizeHistogram[0], ShouldResemble, InventoryStat{Name: "<1KiB", Count: 2, Bytes: 300})
+			So(report.SizeHistogram[3], ShouldResemble, InventoryStat{Name: "<16MiB", Count: 1, Bytes: 2 << 20})
+			So(report.SizeHistogram[len(sizeBounds)-1].Count, ShouldEqual, 1)
+		})
+
+		Convey("storage classes should be sorted by name", func() {
+			So(report.StorageClasses, ShouldHaveLength, 2)
+			So(report.StorageClasses[0].Name, ShouldEqual, s3.StorageClassStandard)
+			So(report.StorageClasses[0].Count, ShouldEqual, 3)
+		})
+
+		Convey("top prefixes should be the largest ones", func() {
+			So(report.TopPrefixes, ShouldResemble, []InventoryStat{
+				{Name: "", Count: 1, Bytes: 6 << 30},
+				{Name: "data/", Count: 1, Bytes: 2 << 20},
+			})
+		})
+
+		Convey("report should be written as JSON and CSV", func() {
+			var jsonBuf, csvBuf bytes.Buffer
+			So(report.WriteJSON(&jsonBuf), ShouldBeNil)
+			var decoded InventoryReport
+			So(json.Unmarshal(jsonBuf.Bytes(), &decoded), ShouldBeNil)
+			So(decoded.Objects, ShouldEqual, report.Objects)
+
+			So(report.WriteCSV(&csvBuf), ShouldBeNil)
+			So(csvBuf.String(), ShouldStartWith, "section,name,count,bytes\n")
+			So(csvBuf.String(), ShouldContainSubstring, "summary,objects,3,")
+			So(strings.Count(csvBuf.String(), "\nprefix,"), ShouldEqual, 2)
+		})
+	})
+}
+
+func Test_inventoryBuilder_prefix(t *testing.T) {
+	Convey("Test_inventoryBuilder_prefix", t, func() {
+		tests := []struct {
+			name      string
+			delimiter string
+			depth     int
+			key       string
+			want      string
+		}{
+			{"key should end at the first delimiter", "/", 1, "a/b/c", "a/"},
+			{"key should end at the second delimiter", "/", 2, "a/b/c", "a/b/"},
+			{"key with fewer delimiters should end at the last one", "/", 3, "a/b/c", "a/b/"},
+			{"key without delimiter should have the empty prefix", "/", 1, "abc", ""},
+			{"empty delimiter should have the empty prefix", "", 1, "a/b", ""},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				b := newInventoryBuilder("abc", tt.delimiter, tt.depth)
+				So(b.prefix(tt.key), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
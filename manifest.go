@@ -0,0 +1,194 @@
+package s3box
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type ManifestFormat int
+
+const (
+	// ManifestJSONL writes a JSON object per line
+	ManifestJSONL ManifestFormat = iota
+	// ManifestCSV writes a header line followed by a record per line
+	ManifestCSV
+)
+
+var manifestCSVHeader = []string{"bucket", "key", "version_id", "upload_id", "delete_marker", "is_latest", "size", "last_modified"}
+
+// ManifestEntry is an object version, a delete marker or a multipart upload to be removed.
+// UploadId is set only for multipart uploads, and their Size is the total size of uploaded parts.
+type ManifestEntry struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	VersionId    string    `json:"version_id,omitempty"`
+	UploadId     string    `json:"upload_id,omitempty"`
+	DeleteMarker bool      `json:"delete_marker,omitempty"`
+	IsLatest     bool      `json:"is_latest,omitempty"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ManifestWriter writes manifest entries, it is safe for concurrent use
+type ManifestWriter struct {
+	mu            sync.Mutex
+	format        ManifestFormat
+	enc           *json.Encoder
+	csv           *csv.Writer
+	headerWritten bool
+	entries       uint64
+	bytes         int64
+}
+
+func NewManifestWriter(w io.Writer, format ManifestFormat) *ManifestWriter {
+	m := &ManifestWriter{
+		format: format,
+	}
+	if format == ManifestCSV {
+		m.csv = csv.NewWriter(w)
+	} else {
+		m.enc = json.NewEncoder(w)
+	}
+	return m
+}
+
+func (m *ManifestWriter) Write(entry *ManifestEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+	if m.format == ManifestCSV {
+		err = m.writeCSV(entry)
+	} else {
+		err = m.enc.Encode(entry)
+	}
+	if err != nil {
+		return err
+	}
+	m.entries++
+	m.bytes += entry.Size
+	return nil
+}
+
+func (m *ManifestWriter) writeCSV(entry *ManifestEntry) error {
+	if !m.headerWritten {
+		if err := m.csv.Write(manifestCSVHeader); err != nil {
+			return err
+		}
+		m.headerWritten = true
+	}
+	return m.csv.Write([]string{
+		entry.Bucket,
+		entry.Key,
+		entry.VersionId,
+		entry.UploadId,
+		strconv.FormatBool(entry.DeleteMarker),
+		strconv.FormatBool(entry.IsLatest),
+		strconv.FormatInt(entry.Size, 10),
+		entry.LastModified.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// Flush writes any buffered data to the underlying io.Writer
+func (m *ManifestWriter) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.csv != nil {
+		m.csv.Flush()
+		return m.csv.Error()
+	}
+	return nil
+}
+
+// Entries returns the number of entries written
+func (m *ManifestWriter) Entries() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries
+}
+
+// Bytes returns the total size of entries written
+func (m *ManifestWriter) Bytes() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bytes
+}
+
+// ManifestReader reads the entries written by ManifestWriter
+type ManifestReader struct {
+	format        ManifestFormat
+	dec           *json.Decoder
+	csv           *csv.Reader
+	headerSkipped bool
+}
+
+func NewManifestReader(r io.Reader, format ManifestFormat) *ManifestReader {
+	m := &ManifestReader{
+		format: format,
+	}
+	if format == ManifestCSV {
+		m.csv = csv.NewReader(r)
+		m.csv.FieldsPerRecord = len(manifestCSVHeader)
+	} else {
+		m.dec = json.NewDecoder(r)
+	}
+	return m
+}
+
+// Read returns the next entry, io.EOF is returned when there are no more entries
+func (m *ManifestReader) Read() (*ManifestEntry, error) {
+	if m.format == ManifestCSV {
+		return m.readCSV()
+	}
+
+	var entry ManifestEntry
+	if err := m.dec.Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (m *ManifestReader) readCSV() (*ManifestEntry, error) {
+	if !m.headerSkipped {
+		if _, err := m.csv.Read(); err != nil {
+			return nil, err
+		}
+		m.headerSkipped = true
+	}
+
+	record, err := m.csv.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &ManifestEntry{
+		Bucket:    record[0],
+		Key:       record[1],
+		VersionId: record[2],
+		UploadId:  record[3],
+	}
+	if entry.DeleteMarker, err = strconv.ParseBool(record[4]); err != nil {
+		return nil, m.fieldErr("delete_marker", err)
+	}
+	if entry.IsLatest, err = strconv.ParseBool(record[5]); err != nil {
+		return nil, m.fieldErr("is_latest", err)
+	}
+	if entry.Size, err = strconv.ParseInt(record[6], 10, 64); err != nil {
+		return nil, m.fieldErr("size", err)
+	}
+	if entry.LastModified, err = time.Parse(time.RFC3339Nano, record[7]); err != nil {
+		return nil, m.fieldErr("last_modified", err)
+	}
+	return entry, nil
+}
+
+func (m *ManifestReader) fieldErr(field string, err error) error {
+	line, _ := m.csv.FieldPos(0)
+	return fmt.Errorf("manifest line %d: invalid %s: %w", line, field, err)
+}
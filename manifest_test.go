@@ -0,0 +1,76 @@
+package s3box
+
+import (
+	"bytes"
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	lastModified := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+	entries := []*ManifestEntry{
+		{Bucket: "abc", Key: "a.txt", VersionId: "v1", IsLatest: true, Size: 100, LastModified: lastModified},
+		{Bucket: "abc", Key: "b,\"quoted\".txt", VersionId: "v2", DeleteMarker: true, LastModified: lastModified},
+		{Bucket: "abc", Key: "big.iso", UploadId: "upload-1", Size: 5 << 20, LastModified: lastModified},
+	}
+
+	Convey("TestManifest", t, func() {
+		tests := []struct {
+			name   string
+			format ManifestFormat
+		}{
+			{"JSONL manifest should be read back", ManifestJSONL},
+			{"CSV manifest should be read back", ManifestCSV},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				var buf bytes.Buffer
+				writer := NewManifestWriter(&buf, tt.format)
+				for _, e := range entries {
+					So(writer.Write(e), ShouldBeNil)
+				}
+				So(writer.Flush(), ShouldBeNil)
+				So(writer.Entries(), ShouldEqual, len(entries))
+				So(writer.Bytes(), ShouldEqual, 100+5<<20)
+
+				reader := NewManifestReader(&buf, tt.format)
+				for _, e := range entries {
+					got, err := reader.Read()
+					So(err, ShouldBeNil)
+					So(*got, ShouldResemble, *e)
+				}
+				_, err := reader.Read()
+				So(err, ShouldEqual, io.EOF)
+			})
+		}
+	})
+}
+
+func TestBucketCleaner_EmptyBucketFromManifest(t *testing.T) {
+	svc := buildS3Client(t)
+	bc := NewBucketCleaner(svc)
+	bc.Progress = NopProgressReporter{}
+
+	Convey("TestBucketCleaner_EmptyBucketFromManifest", t, func() {
+		var buf bytes.Buffer
+		writer := NewManifestWriter(&buf, ManifestJSONL)
+		So(writer.Write(&ManifestEntry{Bucket: "abc", Key: "a.txt", VersionId: "v1", Size: 100}), ShouldBeNil)
+		So(writer.Write(&ManifestEntry{Bucket: "other", Key: "b.txt", VersionId: "v1", Size: 200}), ShouldBeNil)
+		So(writer.Write(&ManifestEntry{Bucket: "abc", Key: "c.iso", UploadId: "upload-1", Size: 300}), ShouldBeNil)
+
+		Convey("dry run should only count the entries of the bucket", func() {
+			bc.DryRun = true
+			got, err := bc.EmptyBucketFromManifest(context.Background(), "abc", &buf, ManifestJSONL, 2, 10, true)
+			So(err, ShouldBeNil)
+			So(got.Listed, ShouldEqual, 1)
+			So(got.Bytes, ShouldEqual, 400)
+			So(got.Deleted, ShouldEqual, 0)
+			So(got.Aborted, ShouldEqual, 0)
+			So(got.Completed, ShouldBeTrue)
+		})
+	})
+}
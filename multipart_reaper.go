@@ -0,0 +1,216 @@
+package s3box
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultStaleUploadAge = 24 * time.Hour
+
+// MultipartReaper aborts the multipart uploads left behind by failed or abandoned uploads
+type MultipartReaper struct {
+	svc *s3.S3
+
+	// OlderThan selects the uploads initiated more than OlderThan ago, 24 hours by default
+	OlderThan time.Duration
+	// Prefix selects the uploads whose keys start with it
+	Prefix string
+	// DryRun makes the reaper sum up the stale uploads without aborting them
+	DryRun bool
+	// WorkerNum is the number of uploads aborted concurrently, 1 by default
+	WorkerNum int
+	// RequestsPerSecond caps the requests listing the parts of and aborting the uploads, 0 means unlimited
+	RequestsPerSecond float64
+}
+
+// ReapResult tells how far a reaper run got, it is partial when the run is canceled
+type ReapResult struct {
+	Bucket string
+	// Listed is the number of uploads under Prefix, Stale is the number of them older than OlderThan
+	Listed  uint64
+	Stale   uint64
+	Aborted uint64
+	Failed  uint64
+	// Bytes is the total size of the parts of aborted uploads, or of stale uploads in dry-run mode
+	Bytes uint64
+	// Unsized is the number of uploads whose parts failed to be listed, they are still aborted
+	// but their sizes are not in Bytes
+	Unsized uint64
+	// Errors holds the per-upload errors, at most maxCleanErrors of them are kept
+	Errors  []ObjectError
+	Elapsed time.Duration
+	// Completed is true only when all the uploads have been walked without being canceled
+	Completed bool
+}
+
+type reapTask struct {
+	ctx        context.Context
+	bucket     string
+	startTime  time.Time
+	reqLimiter *RateLimiter
+
+	listed  uint64
+	stale   uint64
+	aborted uint64
+	failed  uint64
+	bytes   uint64
+	unsized uint64
+
+	mu      sync.Mutex
+	objErrs []ObjectError
+}
+
+func NewMultipartReaper(svc *s3.S3) *MultipartReaper {
+	r := &MultipartReaper{
+		svc:       svc,
+		OlderThan: defaultStaleUploadAge,
+		WorkerNum: 1,
+	}
+	return r
+}
+
+// ReapWithContext aborts the stale multipart uploads of the bucket.
+// A non-nil error is returned if the listing fails, or any stale upload fails to be sized or aborted.
+func (r *MultipartReaper) ReapWithContext(ctx context.Context, bucketName string) (*ReapResult, error) {
+	task := &reapTask{
+		ctx:       ctx,
+		bucket:    bucketName,
+		startTime: time.Now(),
+	}
+	if r.RequestsPerSecond > 0 {
+		task.reqLimiter = NewRateLimiter(r.RequestsPerSecond)
+	}
+	olderThan := r.OlderThan
+	if olderThan <= 0 {
+		olderThan = defaultStaleUploadAge
+	}
+	deadline := task.startTime.Add(-olderThan)
+	workerNum := max(r.WorkerNum, 1)
+
+	var prefix *string
+	if r.Prefix != "" {
+		prefix = aws.String(r.Prefix)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workerNum)
+	uploadChannel := make(chan *s3.MultipartUpload, workerNum)
+	for i := 0; i < workerNum; i++ {
+		go func() {
+			defer wg.Done()
+			for upload := range uploadChannel {
+				r.reap(task, upload)
+			}
+		}()
+	}
+
+	listErr := listUploads(ctx, r.svc, bucketName, prefix, func(upload *s3.MultipartUpload) bool {
+		atomic.AddUint64(&task.listed, 1)
+		if !strings.HasPrefix(aws.StringValue(upload.Key), r.Prefix) || !aws.TimeValue(upload.Initiated).Before(deadline) {
+			return true
+		}
+		atomic.AddUint64(&task.stale, 1)
+		select {
+		case <-ctx.Done():
+			return false
+		case uploadChannel <- upload:
+			return true
+		}
+	})
+	close(uploadChannel)
+	wg.Wait()
+
+	result := task.result()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	var errs []error
+	if listErr != nil {
+		errs = append(errs, fmt.Errorf("list multipart uploads of bucket %s: %w", bucketName, listErr))
+	}
+	if result.Failed > 0 {
+		errs = append(errs, fmt.Errorf("failed to abort %d multipart uploads of bucket %s", result.Failed, bucketName))
+	}
+	result.Completed = len(errs) == 0
+	if result.Unsized > 0 {
+		errs = append(errs, fmt.Errorf("failed to list the parts of %d multipart uploads of bucket %s", result.Unsized, bucketName))
+	}
+	return result, errors.Join(errs...)
+}
+
+// reap sums up the parts of an upload and then aborts it, an upload failed to be sized is aborted as well
+func (r *MultipartReaper) reap(task *reapTask, upload *s3.MultipartUpload) {
+	if task.ctx.Err() != nil {
+		return
+	}
+	size, err := uploadPartsSize(task.ctx, r.svc, task.reqLimiter, task.bucket, upload.Key, upload.UploadId)
+	if err != nil {
+		if task.ctx.Err() != nil {
+			return
+		}
+		atomic.AddUint64(&task.unsized, 1)
+		task.addObjErr(upload, "list parts: ", err)
+	}
+	if r.DryRun {
+		atomic.AddUint64(&task.bytes, uint64(size))
+		return
+	}
+
+	if task.reqLimiter.Wait(task.ctx, 1) != nil {
+		return
+	}
+	_, err = r.svc.AbortMultipartUploadWithContext(task.ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(task.bucket),
+		Key:      upload.Key,
+		UploadId: upload.UploadId,
+	})
+	if err != nil {
+		if task.ctx.Err() == nil {
+			atomic.AddUint64(&task.failed, 1)
+			task.addObjErr(upload, "", err)
+		}
+		return
+	}
+	atomic.AddUint64(&task.aborted, 1)
+	atomic.AddUint64(&task.bytes, uint64(size))
+}
+
+// addObjErr keeps the error of an upload, the message is prefixed by the failed step if any
+func (t *reapTask) addObjErr(upload *s3.MultipartUpload, step string, err error) {
+	code, message := errCodeAndMessage(err)
+	t.mu.Lock()
+	if len(t.objErrs) < maxCleanErrors {
+		t.objErrs = append(t.objErrs, ObjectError{
+			Key:      aws.StringValue(upload.Key),
+			UploadId: aws.StringValue(upload.UploadId),
+			Code:     code,
+			Message:  step + message,
+		})
+	}
+	t.mu.Unlock()
+}
+
+func (t *reapTask) result() *ReapResult {
+	t.mu.Lock()
+	objErrs := append([]ObjectError(nil), t.objErrs...)
+	t.mu.Unlock()
+
+	return &ReapResult{
+		Bucket:  t.bucket,
+		Listed:  atomic.LoadUint64(&t.listed),
+		Stale:   atomic.LoadUint64(&t.stale),
+		Aborted: atomic.LoadUint64(&t.aborted),
+		Failed:  atomic.LoadUint64(&t.failed),
+		Bytes:   atomic.LoadUint64(&t.bytes),
+		Unsized: atomic.LoadUint64(&t.unsized),
+		Errors:  objErrs,
+		Elapsed: time.Since(t.startTime),
+	}
+}
@@ -0,0 +1,141 @@
+package s3box
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMultipartReaper_ReapWithContext(t *testing.T) {
+	svc := buildS3Client(t)
+	reaper := NewMultipartReaper(svc)
+
+	Convey("TestMultipartReaper_ReapWithContext", t, func() {
+		canceledCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		type args struct {
+			ctx       context.Context
+			bucket    string
+			olderThan time.Duration
+			dryRun    bool
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"dry run should success",
+				args{context.Background(), "abc", time.Hour, true},
+				false,
+			},
+			{"ReapWithContext should success",
+				args{context.Background(), "abc", time.Hour, false},
+				false,
+			},
+			{"ReapWithContext should stop when canceled",
+				args{canceledCtx, "abc", time.Hour, false},
+				true,
+			},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				reaper.OlderThan = tt.args.olderThan
+				reaper.DryRun = tt.args.dryRun
+				got, err := reaper.ReapWithContext(tt.args.ctx, tt.args.bucket)
+				So(err != nil, ShouldEqual, tt.wantErr)
+				So(got.Bucket, ShouldEqual, tt.args.bucket)
+				So(got.Completed, ShouldEqual, !tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestMultipartReaper_reap(t *testing.T) {
+	Convey("TestMultipartReaper_reap", t, func() {
+		var aborted []string
+		svc := buildMockS3Client(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			query := req.URL.Query()
+			w.Header().Set("Content-Type", "application/xml")
+			switch {
+			case query.Has("uploads"):
+				fmt.Fprint(w, `<ListMultipartUploadsResult><Bucket>abc</Bucket><IsTruncated>false</IsTruncated>`+
+					`<Upload><Key>a</Key><UploadId>1</UploadId><Initiated>2020-01-01T00:00:00Z</Initiated></Upload>`+
+					`<Upload><Key>b</Key><UploadId>2</UploadId><Initiated>2020-01-01T00:00:00Z</Initiated></Upload>`+
+					`</ListMultipartUploadsResult>`)
+			case req.Method == "GET" && query.Get("uploadId") == "1":
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>denied</Message></Error>`)
+			case req.Method == "GET":
+				fmt.Fprint(w, `<ListPartsResult><IsTruncated>false</IsTruncated><Part><PartNumber>1</PartNumber><Size>5</Size></Part></ListPartsResult>`)
+			case req.Method == "DELETE":
+				aborted = append(aborted, query.Get("uploadId"))
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		reaper := NewMultipartReaper(svc)
+
+		Convey("upload failed to be sized should still be aborted", func() {
+			got, err := reaper.ReapWithContext(context.Background(), "abc")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "failed to list the parts of 1 multipart uploads")
+			So(err.Error(), ShouldNotContainSubstring, "failed to abort")
+			So(aborted, ShouldResemble, []string{"1", "2"})
+			So(got.Aborted, ShouldEqual, 2)
+			So(got.Failed, ShouldEqual, 0)
+			So(got.Unsized, ShouldEqual, 1)
+			So(got.Bytes, ShouldEqual, 5)
+			So(got.Completed, ShouldBeTrue)
+			So(got.Errors, ShouldHaveLength, 1)
+			So(got.Errors[0].UploadId, ShouldEqual, "1")
+			So(got.Errors[0].Message, ShouldEqual, "list parts: denied")
+		})
+	})
+}
+
+func Test_listUploads(t *testing.T) {
+	Convey("Test_listUploads", t, func() {
+		var markers []string
+		svc := buildMockS3Client(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			query := req.URL.Query()
+			markers = append(markers, query.Get("key-marker")+"/"+query.Get("upload-id-marker"))
+			w.Header().Set("Content-Type", "application/xml")
+			if query.Get("upload-id-marker") == "" {
+				fmt.Fprint(w, `<ListMultipartUploadsResult><Bucket>abc</Bucket><IsTruncated>true</IsTruncated>`+
+					`<NextKeyMarker>a</NextKeyMarker><NextUploadIdMarker>1</NextUploadIdMarker>`+
+					`<Upload><Key>a</Key><UploadId>1</UploadId></Upload></ListMultipartUploadsResult>`)
+				return
+			}
+			fmt.Fprint(w, `<ListMultipartUploadsResult><Bucket>abc</Bucket><IsTruncated>false</IsTruncated>`+
+				`<Upload><Key>a</Key><UploadId>2</UploadId></Upload>`+
+				`<Upload><Key>b</Key><UploadId>3</UploadId></Upload></ListMultipartUploadsResult>`)
+		}))
+
+		Convey("uploads of the same key should be paged by both markers", func() {
+			var uploadIds []string
+			err := listUploads(context.Background(), svc, "abc", nil, func(upload *s3.MultipartUpload) bool {
+				uploadIds = append(uploadIds, aws.StringValue(upload.UploadId))
+				return true
+			})
+			So(err, ShouldBeNil)
+			So(uploadIds, ShouldResemble, []string{"1", "2", "3"})
+			So(markers, ShouldResemble, []string{"/", "a/1"})
+		})
+
+		Convey("listing should stop when fn returns false", func() {
+			var uploadIds []string
+			err := listUploads(context.Background(), svc, "abc", nil, func(upload *s3.MultipartUpload) bool {
+				uploadIds = append(uploadIds, aws.StringValue(upload.UploadId))
+				return false
+			})
+			So(err, ShouldBeNil)
+			So(uploadIds, ShouldResemble, []string{"1"})
+		})
+	})
+}
@@ -0,0 +1,147 @@
+package s3box
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ObjectFilter selects the object versions a BucketCleaner works on, zero fields match everything.
+// All the non-zero fields must match for a version to be selected.
+type ObjectFilter struct {
+	// Prefix is also sent to ListObjectVersions and ListMultipartUploads to narrow the listing
+	Prefix    string
+	KeyRegexp *regexp.Regexp
+	// ModifiedBefore selects versions whose LastModified is older than it
+	ModifiedBefore time.Time
+	// ModifiedAfter selects versions whose LastModified is newer than it
+	ModifiedAfter time.Time
+	// MinSize and MaxSize are inclusive, MaxSize is ignored when it is 0. Delete markers have size 0.
+	// Multipart uploads never match when either of them is set, the size of an upload is unknown until it completes.
+	MinSize int64
+	MaxSize int64
+	// Tags requires every tag to be present on the version with the same value.
+	// Tags are fetched by GetObjectTagging for each version, which is much slower than listing.
+	// Delete markers never match when Tags is set.
+	Tags map[string]string
+	// NoncurrentOnly selects versions and delete markers which are not the latest
+	NoncurrentOnly bool
+	// DeleteMarkersOnly selects delete markers only
+	DeleteMarkersOnly bool
+}
+
+func (f *ObjectFilter) prefix() *string {
+	if f == nil || f.Prefix == "" {
+		return nil
+	}
+	return aws.String(f.Prefix)
+}
+
+func (f *ObjectFilter) matchKey(key string) bool {
+	if !strings.HasPrefix(key, f.Prefix) {
+		return false
+	}
+	return f.KeyRegexp == nil || f.KeyRegexp.MatchString(key)
+}
+
+func (f *ObjectFilter) matchTime(t time.Time) bool {
+	if !f.ModifiedBefore.IsZero() && !t.Before(f.ModifiedBefore) {
+		return false
+	}
+	if !f.ModifiedAfter.IsZero() && !t.After(f.ModifiedAfter) {
+		return false
+	}
+	return true
+}
+
+func (f *ObjectFilter) matchSize(size int64) bool {
+	if size < f.MinSize {
+		return false
+	}
+	return f.MaxSize == 0 || size <= f.MaxSize
+}
+
+// matchVersion checks everything except Tags
+func (f *ObjectFilter) matchVersion(v *s3.ObjectVersion) bool {
+	if f == nil {
+		return true
+	}
+	if f.DeleteMarkersOnly {
+		return false
+	}
+	if f.NoncurrentOnly && aws.BoolValue(v.IsLatest) {
+		return false
+	}
+	return f.matchKey(aws.StringValue(v.Key)) &&
+		f.matchTime(aws.TimeValue(v.LastModified)) &&
+		f.matchSize(aws.Int64Value(v.Size))
+}
+
+func (f *ObjectFilter) matchDeleteMarker(m *s3.DeleteMarkerEntry) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Tags) > 0 {
+		return false
+	}
+	if f.NoncurrentOnly && aws.BoolValue(m.IsLatest) {
+		return false
+	}
+	return f.matchKey(aws.StringValue(m.Key)) &&
+		f.matchTime(aws.TimeValue(m.LastModified)) &&
+		f.matchSize(0)
+}
+
+// matchObject checks the latest version listed by ListObjectsV2, Tags is not checked
+func (f *ObjectFilter) matchObject(o *s3.Object) bool {
+	if f == nil {
+		return true
+	}
+	if f.DeleteMarkersOnly || f.NoncurrentOnly {
+		return false
+	}
+	return f.matchKey(aws.StringValue(o.Key)) &&
+		f.matchTime(aws.TimeValue(o.LastModified)) &&
+		f.matchSize(aws.Int64Value(o.Size))
+}
+
+// matchUpload selects the multipart uploads to be aborted by key and initiated time
+func (f *ObjectFilter) matchUpload(u *s3.MultipartUpload) bool {
+	if f == nil {
+		return true
+	}
+	if f.DeleteMarkersOnly || f.NoncurrentOnly || len(f.Tags) > 0 || f.MinSize > 0 || f.MaxSize > 0 {
+		return false
+	}
+	return f.matchKey(aws.StringValue(u.Key)) && f.matchTime(aws.TimeValue(u.Initiated))
+}
+
+// matchTags fetches the tags of a version and compares them with Tags
+func (f *ObjectFilter) matchTags(ctx context.Context, svc *s3.S3, bucketName string, v *s3.ObjectVersion) (bool, error) {
+	if f == nil || len(f.Tags) == 0 {
+		return true, nil
+	}
+
+	output, err := svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket:    aws.String(bucketName),
+		Key:       v.Key,
+		VersionId: v.VersionId,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	tags := make(map[string]string, len(output.TagSet))
+	for _, tag := range output.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	for k, v := range f.Tags {
+		if value, ok := tags[k]; !ok || value != v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
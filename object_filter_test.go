@@ -0,0 +1,102 @@
+package s3box
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestObjectFilter_matchVersion(t *testing.T) {
+	now := time.Now()
+
+	Convey("TestObjectFilter_matchVersion", t, func() {
+		version := &s3.ObjectVersion{
+			Key:          aws.String("logs/2023/app.log"),
+			VersionId:    aws.String("v1"),
+			IsLatest:     aws.Bool(false),
+			LastModified: aws.Time(now.Add(-48 * time.Hour)),
+			Size:         aws.Int64(1024),
+		}
+		tests := []struct {
+			name   string
+			filter *ObjectFilter
+			want   bool
+		}{
+			{"nil filter should match everything", nil, true},
+			{"matched prefix", &ObjectFilter{Prefix: "logs/"}, true},
+			{"unmatched prefix", &ObjectFilter{Prefix: "data/"}, false},
+			{"matched regexp", &ObjectFilter{KeyRegexp: regexp.MustCompile(`\.log$`)}, true},
+			{"unmatched regexp", &ObjectFilter{KeyRegexp: regexp.MustCompile(`\.txt$`)}, false},
+			{"older than cutoff", &ObjectFilter{ModifiedBefore: now.Add(-24 * time.Hour)}, true},
+			{"newer than cutoff", &ObjectFilter{ModifiedAfter: now.Add(-24 * time.Hour)}, false},
+			{"size in range", &ObjectFilter{MinSize: 1024, MaxSize: 2048}, true},
+			{"size out of range", &ObjectFilter{MaxSize: 512}, false},
+			{"noncurrent only", &ObjectFilter{NoncurrentOnly: true}, true},
+			{"delete markers only", &ObjectFilter{DeleteMarkersOnly: true}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(tt.filter.matchVersion(version), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
+
+func TestObjectFilter_matchDeleteMarker(t *testing.T) {
+	Convey("TestObjectFilter_matchDeleteMarker", t, func() {
+		marker := &s3.DeleteMarkerEntry{
+			Key:          aws.String("logs/app.log"),
+			VersionId:    aws.String("v2"),
+			IsLatest:     aws.Bool(true),
+			LastModified: aws.Time(time.Now()),
+		}
+		tests := []struct {
+			name   string
+			filter *ObjectFilter
+			want   bool
+		}{
+			{"delete markers only", &ObjectFilter{DeleteMarkersOnly: true}, true},
+			{"latest delete marker is not noncurrent", &ObjectFilter{NoncurrentOnly: true}, false},
+			{"delete marker has no tags", &ObjectFilter{Tags: map[string]string{"k": "v"}}, false},
+			{"delete marker has size 0", &ObjectFilter{MinSize: 1}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(tt.filter.matchDeleteMarker(marker), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
+
+func TestObjectFilter_matchUpload(t *testing.T) {
+	Convey("TestObjectFilter_matchUpload", t, func() {
+		upload := &s3.MultipartUpload{
+			Key:       aws.String("logs/app.log"),
+			UploadId:  aws.String("1"),
+			Initiated: aws.Time(time.Now()),
+		}
+		tests := []struct {
+			name   string
+			filter *ObjectFilter
+			want   bool
+		}{
+			{"nil filter", nil, true},
+			{"prefix", &ObjectFilter{Prefix: "logs/"}, true},
+			{"other prefix", &ObjectFilter{Prefix: "data/"}, false},
+			{"upload has no tags", &ObjectFilter{Tags: map[string]string{"k": "v"}}, false},
+			{"upload size is unknown for MinSize", &ObjectFilter{MinSize: 1}, false},
+			{"upload size is unknown for MaxSize", &ObjectFilter{MaxSize: 1 << 20}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(tt.filter.matchUpload(upload), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
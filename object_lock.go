@@ -0,0 +1,151 @@
+package s3box
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ObjectLockInfo is the retention and legal hold blocking the deletion of a version
+type ObjectLockInfo struct {
+	// Mode is GOVERNANCE or COMPLIANCE, it is empty if the version has no retention
+	Mode        string
+	RetainUntil time.Time
+	LegalHold   bool
+}
+
+func (i *ObjectLockInfo) String() string {
+	var locks []string
+	if i.Mode != "" {
+		locks = append(locks, fmt.Sprintf("%s retention until %s", i.Mode, i.RetainUntil.Format(time.RFC3339)))
+	}
+	if i.LegalHold {
+		locks = append(locks, "legal hold")
+	}
+	return "locked by " + strings.Join(locks, " and ")
+}
+
+// objectLockEnabled reports whether Object Lock is enabled on the bucket,
+// a bucket whose lock configuration can not be read is taken as not enabled
+func (c *BucketCleaner) objectLockEnabled(ctx context.Context, bucketName string) bool {
+	output, err := c.svc.GetObjectLockConfigurationWithContext(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil || output.ObjectLockConfiguration == nil {
+		return false
+	}
+	return aws.StringValue(output.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled
+}
+
+// objectLockInfo reads the retention and legal hold of a version, nil is returned if there is neither.
+// The requests are rate limited by the task.
+func (c *BucketCleaner) objectLockInfo(task *cleanTask, obj cleanObj) *ObjectLockInfo {
+	info := &ObjectLockInfo{}
+	if !task.wait(1) {
+		return nil
+	}
+	retention, err := c.svc.GetObjectRetentionWithContext(task.ctx, &s3.GetObjectRetentionInput{
+		Bucket:    aws.String(task.bucket),
+		Key:       obj.Key,
+		VersionId: obj.VersionId,
+	})
+	task.feedback(err)
+	if err == nil && retention.Retention != nil {
+		info.Mode = aws.StringValue(retention.Retention.Mode)
+		info.RetainUntil = aws.TimeValue(retention.Retention.RetainUntilDate)
+	}
+
+	if !task.wait(1) {
+		return nil
+	}
+	legalHold, err := c.svc.GetObjectLegalHoldWithContext(task.ctx, &s3.GetObjectLegalHoldInput{
+		Bucket:    aws.String(task.bucket),
+		Key:       obj.Key,
+		VersionId: obj.VersionId,
+	})
+	task.feedback(err)
+	if err == nil && legalHold.LegalHold != nil {
+		info.LegalHold = aws.StringValue(legalHold.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn
+	}
+
+	if info.Mode == "" && !info.LegalHold {
+		return nil
+	}
+	return info
+}
+
+// removeLegalHold turns off the legal hold of a version, rate limited by the task
+func (c *BucketCleaner) removeLegalHold(task *cleanTask, obj cleanObj) error {
+	if !task.wait(1) {
+		return task.ctx.Err()
+	}
+	_, err := c.svc.PutObjectLegalHoldWithContext(task.ctx, &s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(task.bucket),
+		Key:       obj.Key,
+		VersionId: obj.VersionId,
+		LegalHold: &s3.ObjectLockLegalHold{
+			Status: aws.String(s3.ObjectLockLegalHoldStatusOff),
+		},
+	})
+	task.feedback(err)
+	return err
+}
+
+// failDelete records a version which failed to be deleted. On a bucket with Object Lock, the blocking
+// retention or legal hold is attached to the error, and the legal hold is removed and the deletion is
+// retried once if RemoveLegalHolds is set.
+func (c *BucketCleaner) failDelete(task *cleanTask, obj cleanObj, code, message string) {
+	if task.ctx.Err() != nil {
+		return
+	}
+
+	objErr := ObjectError{
+		Key:       aws.StringValue(obj.Key),
+		VersionId: aws.StringValue(obj.VersionId),
+		Code:      code,
+		Message:   message,
+	}
+	if !task.objectLock || !isObjectLockedCode(code) {
+		task.addObjErr(objErr)
+		task.retryLater(obj)
+		return
+	}
+
+	objErr.Lock = c.objectLockInfo(task, obj)
+	if task.ctx.Err() != nil {
+		return
+	}
+	if objErr.Lock != nil && objErr.Lock.LegalHold && c.RemoveLegalHolds {
+		err := c.removeLegalHold(task, obj)
+		if err == nil {
+			if !task.wait(1) {
+				return
+			}
+			_, err = c.svc.DeleteObjectWithContext(task.ctx, c.deleteObjectInput(task, obj))
+			task.feedback(err)
+		}
+		if err == nil {
+			atomic.AddUint64(&task.deleted, 1)
+			return
+		}
+		if task.ctx.Err() != nil {
+			return
+		}
+		objErr.Code, objErr.Message = errCodeAndMessage(err)
+		objErr.Lock = c.objectLockInfo(task, obj)
+		if task.ctx.Err() != nil {
+			return
+		}
+	}
+	task.addObjErr(objErr)
+	task.retryLater(obj)
+}
+
+// isObjectLockedCode reports whether the deletion may be blocked by Object Lock
+func isObjectLockedCode(code string) bool {
+	return code == "AccessDenied" || code == "ObjectLocked"
+}
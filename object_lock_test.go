@@ -0,0 +1,97 @@
+package s3box
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestObjectLockInfo_String(t *testing.T) {
+	retainUntil := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	Convey("TestObjectLockInfo_String", t, func() {
+		tests := []struct {
+			name string
+			info ObjectLockInfo
+			want string
+		}{
+			{"retention", ObjectLockInfo{Mode: "GOVERNANCE", RetainUntil: retainUntil}, "locked by GOVERNANCE retention until 2030-01-01T00:00:00Z"},
+			{"legal hold", ObjectLockInfo{LegalHold: true}, "locked by legal hold"},
+			{"both", ObjectLockInfo{Mode: "COMPLIANCE", RetainUntil: retainUntil, LegalHold: true}, "locked by COMPLIANCE retention until 2030-01-01T00:00:00Z and legal hold"},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(tt.info.String(), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
+
+func TestBucketCleaner_objectLockEnabled(t *testing.T) {
+	svc := buildS3Client(t)
+	bc := NewBucketCleaner(svc)
+
+	Convey("TestBucketCleaner_objectLockEnabled", t, func() {
+		type args struct {
+			bucket string
+		}
+		tests := []struct {
+			name string
+			args args
+			want bool
+		}{
+			{"objectLockEnabled should detect lock configuration", args{"locked-bkt"}, true},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got := bc.objectLockEnabled(context.Background(), tt.args.bucket)
+				So(got, ShouldEqual, tt.want)
+			})
+		}
+	})
+}
+
+func TestBucketCleaner_failDelete(t *testing.T) {
+	Convey("TestBucketCleaner_failDelete", t, func() {
+		bucket := newMockBucket("a")
+		legalHold := "ON"
+		c := NewBucketCleaner(buildMockS3Client(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !req.URL.Query().Has("legal-hold") {
+				bucket.ServeHTTP(w, req)
+				return
+			}
+			if req.Method == "PUT" {
+				legalHold = "OFF"
+				return
+			}
+			fmt.Fprintf(w, `<LegalHold><Status>%s</Status></LegalHold>`, legalHold)
+		})))
+		c.RemoveLegalHolds = true
+		task := &cleanTask{
+			ctx:        context.Background(),
+			bucket:     "abc",
+			objectLock: true,
+			adaptive:   true,
+			reqLimiter: NewRateLimiter(100),
+		}
+		task.reqLimiter.Decrease()
+		obj := cleanObj{ObjectIdentifier: s3.ObjectIdentifier{Key: aws.String("a"), VersionId: aws.String("v1")}}
+
+		Convey("requests removing the legal hold should be rate limited", func() {
+			c.failDelete(task, obj, "AccessDenied", "denied")
+			So(task.deleted, ShouldEqual, 1)
+			So(task.objErrs, ShouldBeEmpty)
+			So(bucket.remaining(), ShouldBeEmpty)
+			// retention, legal hold, removal and deletion
+			So(task.reqLimiter.windowCount, ShouldEqual, 4)
+			So(task.reqLimiter.Limit(), ShouldBeGreaterThan, 50)
+		})
+	})
+}
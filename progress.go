@@ -0,0 +1,91 @@
+package s3box
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Progress is a snapshot of a running BucketCleaner, BucketSyncer or BulkJob task
+type Progress struct {
+	Bucket  string
+	Listed  uint64
+	Deleted uint64
+	Failed  uint64
+	Aborted uint64
+	// Copied is the number of objects copied by a BucketSyncer
+	Copied uint64
+	// Updated is the number of objects changed by a BulkJob
+	Updated uint64
+	Elapsed time.Duration
+	// Rate is the number of objects deleted, copied or updated per second since the previous snapshot
+	Rate float64
+	// Done is true for the last snapshot of a task
+	Done bool
+}
+
+// ProgressReporter receives progress snapshots periodically, Report must not block for long
+type ProgressReporter interface {
+	Report(p Progress)
+}
+
+// ProgressReporterFunc is an adapter to allow the use of ordinary functions as ProgressReporter
+type ProgressReporterFunc func(p Progress)
+
+func (f ProgressReporterFunc) Report(p Progress) {
+	f(p)
+}
+
+// StdoutProgressReporter prints every snapshot to stdout
+type StdoutProgressReporter struct{}
+
+func (StdoutProgressReporter) Report(p Progress) {
+	switch {
+	case p.Copied > 0:
+		fmt.Printf("bucket %s: listed %d, copied %d, deleted %d, failed %d, %.2f objects/s, elapsed %s\n",
+			p.Bucket, p.Listed, p.Copied, p.Deleted, p.Failed, p.Rate, p.Elapsed.Round(time.Second))
+	case p.Updated > 0:
+		fmt.Printf("bucket %s: listed %d, updated %d, failed %d, %.2f objects/s, elapsed %s\n",
+			p.Bucket, p.Listed, p.Updated, p.Failed, p.Rate, p.Elapsed.Round(time.Second))
+	default:
+		fmt.Printf("bucket %s: listed %d, deleted %d, failed %d, aborted %d multipart uploads, %.2f objects/s, elapsed %s\n",
+			p.Bucket, p.Listed, p.Deleted, p.Failed, p.Aborted, p.Rate, p.Elapsed.Round(time.Second))
+	}
+	if p.Done {
+		fmt.Printf("bucket %s: all task completed\n", p.Bucket)
+	}
+}
+
+// NopProgressReporter discards every snapshot
+type NopProgressReporter struct{}
+
+func (NopProgressReporter) Report(Progress) {}
+
+// reportProgress sends a snapshot to reporter every interval until ctx is done
+func reportProgress(ctx context.Context, reporter ProgressReporter, interval time.Duration, snapshot func() Progress) {
+	timeTicker := time.NewTicker(interval)
+	defer timeTicker.Stop()
+
+	last := snapshot()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeTicker.C:
+		}
+		p := snapshot()
+		p.Rate = rate(last, p)
+		reporter.Report(p)
+		last = p
+	}
+}
+
+// rate calculates the number of objects deleted, copied or updated per second between two snapshots
+func rate(prev, cur Progress) float64 {
+	timeDiff := cur.Elapsed - prev.Elapsed
+	if timeDiff <= 0 {
+		return 0
+	}
+	done := cur.Deleted + cur.Copied + cur.Updated - prev.Deleted - prev.Copied - prev.Updated
+	return float64(done) / timeDiff.Seconds()
+}
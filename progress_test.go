@@ -0,0 +1,59 @@
+package s3box
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestBucketCleaner_Progress(t *testing.T) {
+	svc := buildS3Client(t)
+	bc := NewBucketCleaner(svc)
+
+	Convey("TestBucketCleaner_Progress", t, func() {
+		var reports []Progress
+		bc.Progress = ProgressReporterFunc(func(p Progress) {
+			reports = append(reports, p)
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Convey("the last snapshot should be reported when the task ends", func() {
+			_, err := bc.EmptyBucketWithContext(ctx, "abc", 1, 10, true, false)
+			So(err, ShouldEqual, context.Canceled)
+			So(reports, ShouldNotBeEmpty)
+			So(reports[len(reports)-1].Done, ShouldBeTrue)
+			So(reports[len(reports)-1].Bucket, ShouldEqual, "abc")
+		})
+	})
+}
+
+func TestProgress_rate(t *testing.T) {
+	Convey("TestProgress_rate", t, func() {
+		type args struct {
+			prev Progress
+			cur  Progress
+		}
+		tests := []struct {
+			name string
+			args args
+			want float64
+		}{
+			{"rate should count objects deleted between snapshots",
+				args{Progress{Deleted: 1000, Elapsed: time.Second}, Progress{Deleted: 3000, Elapsed: 3 * time.Second}},
+				1000,
+			},
+			{"rate should be zero without elapsed time",
+				args{Progress{Deleted: 1000, Elapsed: time.Second}, Progress{Deleted: 1000, Elapsed: time.Second}},
+				0,
+			},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(rate(tt.args.prev, tt.args.cur), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
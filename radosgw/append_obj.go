@@ -1,34 +1,22 @@
 package radosgw
 
 import (
+	"context"
 	"fmt"
-	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/regenttsui/s3box/utils"
 	"io"
 	"net/http"
-	"time"
 )
 
-func (rgw *RGWClient) AppendObjV2(bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s/%s?append&position=%d", *rgw.config.Endpoint, bucketName, objKey, position)
-	req, err := http.NewRequest("PUT", url, body)
-	if err != nil {
-		return nil, err
-	}
-
-	err = utils.SetContentLengthHeader(req, body)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := rgw.buildSignerV2AndSendReq(req)
-
-	return resp, err
+// AppendObj appends body to the object at position, the request is signed with the SignatureVersion of the client
+func (rgw *RGWClient) AppendObj(bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
+	return rgw.AppendObjWithContext(context.Background(), bucketName, objKey, position, body)
 }
 
-func (rgw *RGWClient) AppendObjV4(bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
+// AppendObjWithContext is the same as AppendObj with a context to cancel the request
+func (rgw *RGWClient) AppendObjWithContext(ctx context.Context, bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
 	url := fmt.Sprintf("%s/%s/%s?append&position=%d", *rgw.config.Endpoint, bucketName, objKey, position)
-	req, err := http.NewRequest("PUT", url, body)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -38,13 +26,37 @@ func (rgw *RGWClient) AppendObjV4(bucketName, objKey string, position uint64, bo
 		return nil, err
 	}
 
-	signer := v4.NewSigner(rgw.config.Credentials)
-	_, err = signer.Sign(req, body, "s3", "region", time.Now())
+	resp, err := rgw.sendReq(req, body, false)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.httpClient.Do(req)
+	return resp, checkResponse(resp)
+}
+
+// Deprecated: AppendObjV2 is AppendObj signed with SignatureV2, use AppendObj instead
+func (rgw *RGWClient) AppendObjV2(bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
+	return rgw.AppendObjV2WithContext(context.Background(), bucketName, objKey, position, body)
+}
+
+// Deprecated: AppendObjV2WithContext is AppendObjWithContext signed with SignatureV2, use AppendObjWithContext instead
+func (rgw *RGWClient) AppendObjV2WithContext(ctx context.Context, bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
+	return rgw.withSignatureVersion(SignatureV2).AppendObjWithContext(ctx, bucketName, objKey, position, body)
+}
+
+// Deprecated: AppendObjV4 is AppendObj signed with SignatureV4, use AppendObj instead
+func (rgw *RGWClient) AppendObjV4(bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
+	return rgw.AppendObjV4WithContext(context.Background(), bucketName, objKey, position, body)
+}
+
+// Deprecated: AppendObjV4WithContext is AppendObjWithContext signed with SignatureV4, use AppendObjWithContext instead
+func (rgw *RGWClient) AppendObjV4WithContext(ctx context.Context, bucketName, objKey string, position uint64, body io.ReadSeeker) (*http.Response, error) {
+	return rgw.withSignatureVersion(SignatureV4).AppendObjWithContext(ctx, bucketName, objKey, position, body)
+}
 
-	return resp, err
+// withSignatureVersion returns a copy of the client which signs the requests with version
+func (rgw *RGWClient) withSignatureVersion(version SignatureVersion) *RGWClient {
+	client := *rgw
+	client.SignatureVersion = version
+	return &client
 }
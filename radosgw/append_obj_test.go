@@ -104,3 +104,42 @@ func TestRGWClient_AppendObjV4(t *testing.T) {
 		}
 	})
 }
+
+func TestRGWClient_AppendObj(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_AppendObj", t, func() {
+		type args struct {
+			bucketName string
+			objKey     string
+			position   uint64
+			fileName   string
+		}
+		tests := []struct {
+			name    string
+			version SignatureVersion
+			args    args
+			want    int
+			wantErr bool
+		}{
+			{"AppendObj with signature V2 should success", SignatureV2, args{"bkt", "obj-v2", 0, "D:/test.txt"}, 200, false},
+			{"AppendObj with signature V4 should success", SignatureV4, args{"bkt", "obj-v4", 0, "D:/test.txt"}, 200, false},
+		}
+
+		for _, tt := range tests {
+			file, err := os.Open(tt.args.fileName)
+			if err != nil {
+				t.Logf("Couldn't open file %v to upload. Here's why: %v\n", tt.args.fileName, err)
+			}
+			defer file.Close()
+			Convey(tt.name, func() {
+				rgw.SignatureVersion = tt.version
+				got, err := rgw.AppendObj(tt.args.bucketName, tt.args.objKey, tt.args.position, file)
+				So(got, ShouldNotBeNil)
+				So(got.StatusCode, ShouldEqual, tt.want)
+				So(err, ShouldBeNil)
+				t.Log(got)
+			})
+		}
+	})
+}
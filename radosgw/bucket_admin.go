@@ -0,0 +1,229 @@
+package radosgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-querystring/query"
+)
+
+// listBucketsConf is the query of ListBuckets, all the buckets are listed without Uid
+type listBucketsConf struct {
+	Uid string `url:"uid,omitempty"`
+}
+
+type RemoveBucketConf struct {
+	Bucket string `url:"bucket"`
+	// PurgeObjects removes the objects of the bucket first, or else only an empty bucket can be removed
+	PurgeObjects bool `url:"purge-objects,omitempty"`
+}
+
+type LinkBucketConf struct {
+	Bucket string `url:"bucket"`
+	// BucketID is the id of the bucket, it is required by RGW before Jewel
+	BucketID string `url:"bucket-id,omitempty"`
+	// Uid is the new owner of the bucket
+	Uid string `url:"uid"`
+	// NewBucketName renames the bucket while linking it
+	NewBucketName string `url:"new-bucket-name,omitempty"`
+}
+
+type UnlinkBucketConf struct {
+	Bucket string `url:"bucket"`
+	Uid    string `url:"uid"`
+}
+
+type CheckBucketIndexConf struct {
+	Bucket string `url:"bucket"`
+	// CheckObjects recalculates the stats of the bucket from its objects
+	CheckObjects bool `url:"check-objects,omitempty"`
+	// Fix repairs the index with the result of the check
+	Fix bool `url:"fix,omitempty"`
+}
+
+type BucketIndexCheck struct {
+	InvalidMultipartEntries []string `json:"invalid_multipart_entries"`
+	CheckResult             struct {
+		ExistingHeader   BucketIndexHeader `json:"existing_header"`
+		CalculatedHeader BucketIndexHeader `json:"calculated_header"`
+	} `json:"check_result"`
+}
+
+// BucketIndexHeader holds the stats of a bucket index by category, such as rgw.main and rgw.multimeta
+type BucketIndexHeader struct {
+	Usage map[string]RGWMain `json:"usage"`
+}
+
+// ListBuckets returns the names of the buckets of the user, or of all the buckets if uid is empty
+func (rgw *RGWClient) ListBuckets(uid string) ([]string, error) {
+	return rgw.ListBucketsWithContext(context.Background(), uid)
+}
+
+// ListBucketsWithContext is the same as ListBuckets with a context to cancel the request
+func (rgw *RGWClient) ListBucketsWithContext(ctx context.Context, uid string) ([]string, error) {
+	v, _ := query.Values(&listBucketsConf{Uid: uid})
+	url := fmt.Sprintf("%s/admin/bucket?%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buff, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []string
+	err = json.Unmarshal(buff, &buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	return buckets, err
+}
+
+func (rgw *RGWClient) RemoveBucket(bucketConf *RemoveBucketConf) error {
+	return rgw.RemoveBucketWithContext(context.Background(), bucketConf)
+}
+
+// RemoveBucketWithContext is the same as RemoveBucket with a context to cancel the request
+func (rgw *RGWClient) RemoveBucketWithContext(ctx context.Context, bucketConf *RemoveBucketConf) error {
+	if bucketConf.Bucket == "" {
+		return errors.New("bucket is required")
+	}
+
+	v, _ := query.Values(bucketConf)
+	url := fmt.Sprintf("%s/admin/bucket?%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, nil, false)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readResponse(resp)
+	return err
+}
+
+// LinkBucket links the bucket to the user and unlinks it from its former owner
+func (rgw *RGWClient) LinkBucket(bucketConf *LinkBucketConf) error {
+	return rgw.LinkBucketWithContext(context.Background(), bucketConf)
+}
+
+// LinkBucketWithContext is the same as LinkBucket with a context to cancel the request
+func (rgw *RGWClient) LinkBucketWithContext(ctx context.Context, bucketConf *LinkBucketConf) error {
+	if bucketConf.Bucket == "" {
+		return errors.New("bucket is required")
+	}
+	if bucketConf.Uid == "" {
+		return errors.New("uid is required")
+	}
+
+	v, _ := query.Values(bucketConf)
+	url := fmt.Sprintf("%s/admin/bucket?%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readResponse(resp)
+	return err
+}
+
+// UnlinkBucket unlinks the bucket from the user, the bucket is left without an owner
+func (rgw *RGWClient) UnlinkBucket(bucketConf *UnlinkBucketConf) error {
+	return rgw.UnlinkBucketWithContext(context.Background(), bucketConf)
+}
+
+// UnlinkBucketWithContext is the same as UnlinkBucket with a context to cancel the request
+func (rgw *RGWClient) UnlinkBucketWithContext(ctx context.Context, bucketConf *UnlinkBucketConf) error {
+	if bucketConf.Bucket == "" {
+		return errors.New("bucket is required")
+	}
+	if bucketConf.Uid == "" {
+		return errors.New("uid is required")
+	}
+
+	v, _ := query.Values(bucketConf)
+	url := fmt.Sprintf("%s/admin/bucket?%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readResponse(resp)
+	return err
+}
+
+// CheckBucketIndex checks the index of the bucket, and fixes it if bucketConf.Fix is set
+func (rgw *RGWClient) CheckBucketIndex(bucketConf *CheckBucketIndexConf) (*BucketIndexCheck, error) {
+	return rgw.CheckBucketIndexWithContext(context.Background(), bucketConf)
+}
+
+// CheckBucketIndexWithContext is the same as CheckBucketIndex with a context to cancel the request
+func (rgw *RGWClient) CheckBucketIndexWithContext(ctx context.Context, bucketConf *CheckBucketIndexConf) (*BucketIndexCheck, error) {
+	if bucketConf.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+
+	v, _ := query.Values(bucketConf)
+	url := fmt.Sprintf("%s/admin/bucket?index&%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buff, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var check BucketIndexCheck
+	err = json.Unmarshal(buff, &check)
+	if err != nil {
+		return nil, err
+	}
+
+	return &check, err
+}
@@ -0,0 +1,196 @@
+package radosgw
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestRGWClient_ListBuckets(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_ListBuckets", t, func() {
+		type args struct {
+			uid string
+		}
+		tests := []struct {
+			name    string
+			args    args
+			want    string
+			wantErr bool
+		}{
+			{"ListBuckets of a user should success", args{"quota-user"}, "test-bkt", false},
+			{"ListBuckets of all users should success", args{""}, "test-bkt", false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.ListBuckets(tt.args.uid)
+				So(err, ShouldBeNil)
+				So(got, ShouldContain, tt.want)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_LinkBucket(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_LinkBucket", t, func() {
+		type args struct {
+			bucketConf LinkBucketConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"LinkBucket should success", args{LinkBucketConf{Bucket: "test-bkt", Uid: "new-user"}}, false},
+			{"LinkBucket without uid should fail", args{LinkBucketConf{Bucket: "test-bkt"}}, true},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				err := rgw.LinkBucket(&tt.args.bucketConf)
+				So(err != nil, ShouldEqual, tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestRGWClient_UnlinkBucket(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_UnlinkBucket", t, func() {
+		type args struct {
+			bucketConf UnlinkBucketConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"UnlinkBucket should success", args{UnlinkBucketConf{Bucket: "test-bkt", Uid: "new-user"}}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				err := rgw.UnlinkBucket(&tt.args.bucketConf)
+				So(err != nil, ShouldEqual, tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestRGWClient_CheckBucketIndex(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_CheckBucketIndex", t, func() {
+		type args struct {
+			bucketConf CheckBucketIndexConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"CheckBucketIndex should success", args{CheckBucketIndexConf{Bucket: "test-bkt", CheckObjects: true}}, false},
+			{"CheckBucketIndex with fix should success", args{CheckBucketIndexConf{Bucket: "test-bkt", Fix: true}}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.CheckBucketIndex(&tt.args.bucketConf)
+				So(err, ShouldBeNil)
+				So(got, ShouldNotBeNil)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_RemoveBucket(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_RemoveBucket", t, func() {
+		type args struct {
+			bucketConf RemoveBucketConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"RemoveBucket with purge-objects should success", args{RemoveBucketConf{Bucket: "test-bkt", PurgeObjects: true}}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				err := rgw.RemoveBucket(&tt.args.bucketConf)
+				So(err != nil, ShouldEqual, tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestRGWClient_bucketAdminRequests(t *testing.T) {
+	Convey("TestRGWClient_bucketAdminRequests", t, func() {
+		var method, rawQuery string
+		var reply string
+		rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			method, rawQuery = req.Method, req.URL.RawQuery
+			io.WriteString(w, reply)
+		}))
+
+		tests := []struct {
+			name       string
+			reply      string
+			call       func() error
+			wantMethod string
+			wantQuery  string
+		}{
+			{"ListBuckets", `["bkt1","bkt2"]`, func() error {
+				got, err := rgw.ListBuckets("user")
+				So(got, ShouldResemble, []string{"bkt1", "bkt2"})
+				return err
+			}, "GET", "uid=user"},
+			{"ListBuckets should escape the uid", `[]`, func() error {
+				_, err := rgw.ListBuckets("tenant$user&stats=true")
+				return err
+			}, "GET", "uid=tenant%24user%26stats%3Dtrue"},
+			{"ListBuckets of all users", `[]`, func() error {
+				_, err := rgw.ListBuckets("")
+				return err
+			}, "GET", ""},
+			{"RemoveBucket", "", func() error {
+				return rgw.RemoveBucket(&RemoveBucketConf{Bucket: "bkt", PurgeObjects: true})
+			}, "DELETE", "bucket=bkt&purge-objects=true"},
+			{"LinkBucket", "", func() error {
+				return rgw.LinkBucket(&LinkBucketConf{Bucket: "bkt", BucketID: "id", Uid: "user"})
+			}, "PUT", "bucket=bkt&bucket-id=id&uid=user"},
+			{"UnlinkBucket", "", func() error {
+				return rgw.UnlinkBucket(&UnlinkBucketConf{Bucket: "bkt", Uid: "user"})
+			}, "POST", "bucket=bkt&uid=user"},
+			{"CheckBucketIndex", `{"invalid_multipart_entries":["_multipart_obj.2~abc.meta"],` +
+				`"check_result":{"existing_header":{"usage":{"rgw.main":{"num_objects":3}}},` +
+				`"calculated_header":{"usage":{"rgw.main":{"num_objects":2}}}}}`, func() error {
+				got, err := rgw.CheckBucketIndex(&CheckBucketIndexConf{Bucket: "bkt", CheckObjects: true, Fix: true})
+				So(got.InvalidMultipartEntries, ShouldHaveLength, 1)
+				So(got.CheckResult.ExistingHeader.Usage["rgw.main"].NumObjects, ShouldEqual, 3)
+				So(got.CheckResult.CalculatedHeader.Usage["rgw.main"].NumObjects, ShouldEqual, 2)
+				return err
+			}, "GET", "index&bucket=bkt&check-objects=true&fix=true"},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				reply = tt.reply
+				So(tt.call(), ShouldBeNil)
+				So(method, ShouldEqual, tt.wantMethod)
+				So(rawQuery, ShouldEqual, tt.wantQuery)
+			})
+		}
+	})
+}
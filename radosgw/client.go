@@ -2,34 +2,64 @@ package radosgw
 
 import (
 	"github.com/aws/aws-sdk-go/aws"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/regenttsui/s3box"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 )
 
+// SignatureVersion is the version of the signature with which RGWClient signs the requests
+type SignatureVersion int
+
+const (
+	// SignatureV2 is the AWS signature version 2
+	SignatureV2 SignatureVersion = iota
+	// SignatureV4 is the AWS signature version 4 with the region of the client config,
+	// it is needed by the RGW deployments with signature V2 disabled
+	SignatureV4
+)
+
+// defaultSigningRegion is used with SignatureV4 if the client config has no region
+const defaultSigningRegion = "us-east-1"
+
 type RGWClient struct {
 	config     *aws.Config
 	httpClient *http.Client
+
+	// RetryPolicy is DefaultRetryPolicy by default
+	RetryPolicy RetryPolicy
+	// SignatureVersion applies to all the requests, SignatureV2 by default
+	SignatureVersion SignatureVersion
 }
 
 func NewRGWClient(conf *aws.Config, httpClient *http.Client) *RGWClient {
 	*conf.Endpoint = strings.TrimRight(*conf.Endpoint, "/")
 	client := &RGWClient{
-		config:     conf,
-		httpClient: httpClient,
+		config:      conf,
+		httpClient:  httpClient,
+		RetryPolicy: DefaultRetryPolicy(),
 	}
 	return client
 }
 
-func (rgw *RGWClient) buildSignerV2AndSendReq(req *http.Request) (*http.Response, error) {
-	signer := s3box.NewSigner(*rgw.config, time.Now())
-	err := signer.Sign(req)
-	if err != nil {
-		return nil, err
+// signReq signs the request with SignatureVersion, body is the body of req
+func (rgw *RGWClient) signReq(req *http.Request, body io.ReadSeeker) error {
+	switch rgw.SignatureVersion {
+	case SignatureV4:
+		region := aws.StringValue(rgw.config.Region)
+		if region == "" {
+			region = defaultSigningRegion
+		}
+		// the path is escaped already, and S3 does not escape it again in the canonical request
+		signer := v4.NewSigner(rgw.config.Credentials, func(s *v4.Signer) {
+			s.DisableURIPathEscaping = true
+		})
+		_, err := signer.Sign(req, body, "s3", region, time.Now())
+		return err
+	default:
+		signer := s3box.NewSigner(*rgw.config, time.Now())
+		return signer.Sign(req)
 	}
-
-	resp, err := rgw.httpClient.Do(req)
-
-	return resp, err
 }
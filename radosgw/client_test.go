@@ -0,0 +1,98 @@
+package radosgw
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifyV4 checks the V4 signature of a request the way S3 does, the canonical URI is the path as it is sent
+func verifyV4(req *http.Request, body []byte) bool {
+	authorization := req.Header.Get("Authorization")
+	_, signedHeaders, _ := strings.Cut(authorization, "SignedHeaders=")
+	signedHeaders, _, _ = strings.Cut(signedHeaders, ",")
+	date, err := time.Parse("20060102T150405Z", req.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	check, err := http.NewRequest(req.Method, "http://"+req.Host+req.RequestURI, nil)
+	if err != nil {
+		return false
+	}
+	for _, name := range strings.Split(signedHeaders, ";") {
+		switch name {
+		case "host":
+		case "content-length":
+			check.Header.Set(name, strconv.FormatInt(req.ContentLength, 10))
+		default:
+			check.Header.Set(name, req.Header.Get(name))
+		}
+	}
+	signer := v4.NewSigner(credentials.NewStaticCredentials("ak", "sk", ""), func(s *v4.Signer) {
+		s.DisableURIPathEscaping = true
+	})
+	_, err = signer.Sign(check, bytes.NewReader(body), "s3", "mock-region", date)
+	return err == nil && check.Header.Get("Authorization") == authorization
+}
+
+func TestRGWClient_signReq(t *testing.T) {
+	Convey("TestRGWClient_signReq", t, func() {
+		tests := []struct {
+			name       string
+			version    SignatureVersion
+			region     *string
+			wantPrefix string
+			wantScope  string
+		}{
+			{"V2 should be used by default", SignatureV2, aws.String("mock-region"), "AWS ak:", ""},
+			{"V4 should use the region of the config", SignatureV4, aws.String("mock-region"), "AWS4-HMAC-SHA256 Credential=ak/", "/mock-region/s3/aws4_request"},
+			{"V4 should use the default region without one", SignatureV4, nil, "AWS4-HMAC-SHA256 Credential=ak/", "/us-east-1/s3/aws4_request"},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				var authorization string
+				rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					authorization = req.Header.Get("Authorization")
+					w.Write([]byte("{}"))
+				}))
+				rgw.config.Region = tt.region
+				rgw.SignatureVersion = tt.version
+
+				_, err := rgw.GetUserInfo("user", "false")
+				So(err, ShouldBeNil)
+				So(authorization, ShouldStartWith, tt.wantPrefix)
+				So(authorization, ShouldContainSubstring, tt.wantScope)
+			})
+		}
+
+		Convey("V4 signature of keys to be escaped should be accepted", func() {
+			var paths []string
+			rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				paths = append(paths, req.URL.EscapedPath())
+				body, _ := io.ReadAll(req.Body)
+				if !verifyV4(req, body) {
+					w.WriteHeader(http.StatusForbidden)
+					io.WriteString(w, `<Error><Code>SignatureDoesNotMatch</Code></Error>`)
+				}
+			}))
+			rgw.SignatureVersion = SignatureV4
+
+			for _, key := range []string{"obj", "my key", "dir/a+b"} {
+				resp, err := rgw.AppendObj("bkt", key, 0, strings.NewReader("data"))
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			}
+			So(paths, ShouldResemble, []string{"/bkt/obj", "/bkt/my%20key", "/bkt/dir/a+b"})
+		})
+	})
+}
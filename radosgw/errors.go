@@ -0,0 +1,105 @@
+package radosgw
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Error codes of RGW checked by the Is* helpers
+const (
+	ErrCodeNoSuchUser        = "NoSuchUser"
+	ErrCodeNoSuchBucket      = "NoSuchBucket"
+	ErrCodeUserAlreadyExists = "UserAlreadyExists"
+	ErrCodeAccessDenied      = "AccessDenied"
+)
+
+// ErrorResponse represents an AWS S3/RGW error response, which is an XML one from the S3 and pubsub APIs
+// Format: <Error><Code>...</Code><Message>...</Message><Resource>...</Resource><RequestId>...</RequestId></Error>
+// or a JSON one from the admin API
+// Format: {"Code":...,"RequestId":...,"HostId":...}
+type ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error" json:"-"`
+	Text      string   `xml:",chardata" json:"-"`
+	Code      string   `xml:"Code" json:"Code"`
+	Message   string   `xml:"Message" json:"Message"`
+	Resource  string   `xml:"Resource" json:"Resource"`
+	RequestId string   `xml:"RequestId" json:"RequestId"`
+	HostId    string   `xml:"HostId" json:"HostId"`
+	// StatusCode is the HTTP status code of the response
+	StatusCode int `xml:"-" json:"-"`
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("%s: %s (StatusCode: %d, RequestId: %s)", e.Code, e.Message, e.StatusCode, e.RequestId)
+}
+
+// parseErrorResponse decodes an XML or JSON error response, the body is kept as Message if it is neither of them
+func parseErrorResponse(statusCode int, buff []byte) *ErrorResponse {
+	var errResp ErrorResponse
+	if xml.Unmarshal(buff, &errResp) != nil || errResp.Code == "" {
+		errResp = ErrorResponse{}
+		if json.Unmarshal(buff, &errResp) != nil || errResp.Code == "" {
+			errResp = ErrorResponse{Message: strings.TrimSpace(string(buff))}
+		}
+	}
+	errResp.StatusCode = statusCode
+	return &errResp
+}
+
+// readResponse reads the body of a response, an *ErrorResponse is returned if the status code is not 2xx
+func readResponse(resp *http.Response) ([]byte, error) {
+	buff, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, parseErrorResponse(resp.StatusCode, buff)
+	}
+	return buff, nil
+}
+
+// checkResponse returns an *ErrorResponse if the status code of a response is not 2xx.
+// The body is read in that case, and then replaced by a buffered one.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	buff, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(buff))
+	if err != nil {
+		return err
+	}
+	return parseErrorResponse(resp.StatusCode, buff)
+}
+
+// IsNoSuchUser tells whether err is an error response of a user which does not exist
+func IsNoSuchUser(err error) bool {
+	return hasErrorCode(err, ErrCodeNoSuchUser)
+}
+
+// IsNoSuchBucket tells whether err is an error response of a bucket which does not exist
+func IsNoSuchBucket(err error) bool {
+	return hasErrorCode(err, ErrCodeNoSuchBucket)
+}
+
+// IsUserExists tells whether err is an error response of creating a user which already exists
+func IsUserExists(err error) bool {
+	return hasErrorCode(err, ErrCodeUserAlreadyExists)
+}
+
+// IsAccessDenied tells whether err is an error response of a request without the permission
+func IsAccessDenied(err error) bool {
+	return hasErrorCode(err, ErrCodeAccessDenied)
+}
+
+func hasErrorCode(err error, code string) bool {
+	var errResp *ErrorResponse
+	return errors.As(err, &errResp) && errResp.Code == code
+}
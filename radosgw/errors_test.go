@@ -0,0 +1,117 @@
+package radosgw
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func Test_parseErrorResponse(t *testing.T) {
+	Convey("Test_parseErrorResponse", t, func() {
+		tests := []struct {
+			name       string
+			statusCode int
+			body       string
+			want       ErrorResponse
+		}{
+			{"xml error", 404, `<Error><Code>NoSuchBucket</Code><Message>no such bucket</Message><RequestId>tx1</RequestId></Error>`,
+				ErrorResponse{Code: "NoSuchBucket", Message: "no such bucket", RequestId: "tx1", StatusCode: 404}},
+			{"json error", 404, `{"Code":"NoSuchUser","RequestId":"tx2","HostId":"host"}`,
+				ErrorResponse{Code: "NoSuchUser", RequestId: "tx2", HostId: "host", StatusCode: 404}},
+			{"unknown error", 502, "bad gateway\n", ErrorResponse{Message: "bad gateway", StatusCode: 502}},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got := parseErrorResponse(tt.statusCode, []byte(tt.body))
+				So(got.Code, ShouldEqual, tt.want.Code)
+				So(got.Message, ShouldEqual, tt.want.Message)
+				So(got.RequestId, ShouldEqual, tt.want.RequestId)
+				So(got.HostId, ShouldEqual, tt.want.HostId)
+				So(got.StatusCode, ShouldEqual, tt.want.StatusCode)
+			})
+		}
+	})
+}
+
+func TestIsErrorCode(t *testing.T) {
+	Convey("TestIsErrorCode", t, func() {
+		tests := []struct {
+			name string
+			is   func(error) bool
+			err  error
+			want bool
+		}{
+			{"NoSuchUser", IsNoSuchUser, &ErrorResponse{Code: ErrCodeNoSuchUser}, true},
+			{"wrapped NoSuchBucket", IsNoSuchBucket, fmt.Errorf("get bucket: %w", &ErrorResponse{Code: ErrCodeNoSuchBucket}), true},
+			{"UserAlreadyExists", IsUserExists, &ErrorResponse{Code: ErrCodeUserAlreadyExists}, true},
+			{"AccessDenied", IsAccessDenied, &ErrorResponse{Code: ErrCodeAccessDenied}, true},
+			{"other code", IsNoSuchUser, &ErrorResponse{Code: ErrCodeAccessDenied}, false},
+			{"other error", IsNoSuchUser, errors.New(ErrCodeNoSuchUser), false},
+			{"nil", IsNoSuchUser, nil, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(tt.is(tt.err), ShouldEqual, tt.want)
+			})
+		}
+	})
+}
+
+func TestRGWClient_errorResponse(t *testing.T) {
+	Convey("TestRGWClient_errorResponse", t, func() {
+		Convey("admin error should be typed", func() {
+			rgw, _ := buildReplayRGWClient(t, []int{404}, []string{`{"Code":"NoSuchUser","RequestId":"tx","HostId":"host"}`})
+			got, err := rgw.GetUserInfo("nobody", "false")
+			So(got, ShouldBeNil)
+			So(IsNoSuchUser(err), ShouldBeTrue)
+			var errResp *ErrorResponse
+			So(errors.As(err, &errResp), ShouldBeTrue)
+			So(errResp.StatusCode, ShouldEqual, http.StatusNotFound)
+			So(errResp.HostId, ShouldEqual, "host")
+		})
+
+		Convey("response should be returned with the error", func() {
+			body := `{"Code":"AccessDenied","RequestId":"tx","HostId":"host"}`
+			rgw, _ := buildReplayRGWClient(t, []int{403}, []string{body})
+			got, err := rgw.RemoveUser("user")
+			So(IsAccessDenied(err), ShouldBeTrue)
+			So(got, ShouldNotBeNil)
+			defer got.Body.Close()
+			So(got.StatusCode, ShouldEqual, http.StatusForbidden)
+			buff, err := io.ReadAll(got.Body)
+			So(err, ShouldBeNil)
+			So(string(buff), ShouldEqual, body)
+		})
+
+		Convey("pubsub error should be typed", func() {
+			rgw, _ := buildReplayRGWClient(t, []int{403}, []string{`<Error><Code>AccessDenied</Code><Message>denied</Message></Error>`})
+			got, err := rgw.ListTopics()
+			So(got, ShouldBeNil)
+			So(IsAccessDenied(err), ShouldBeTrue)
+		})
+
+		Convey("missing topic should be an error response", func() {
+			rgw, _ := buildReplayRGWClient(t, []int{404}, []string{`<Error><Code>NoSuchKey</Code><Message>no topic</Message></Error>`})
+			got, err := rgw.GetTopic("arn:aws:sns:default::nobody")
+			So(got, ShouldBeNil)
+			var errResp *ErrorResponse
+			So(errors.As(err, &errResp), ShouldBeTrue)
+			So(errResp.Code, ShouldEqual, "NoSuchKey")
+			So(errResp.StatusCode, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("missing notification should be an error response", func() {
+			rgw, _ := buildReplayRGWClient(t, []int{404}, []string{`<Error><Code>NoSuchKey</Code></Error>`})
+			got, err := rgw.GetNotification("test", "nobody")
+			So(got, ShouldBeNil)
+			var errResp *ErrorResponse
+			So(errors.As(err, &errResp), ShouldBeTrue)
+			So(errResp.StatusCode, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package radosgw
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/regenttsui/s3box"
+)
+
+// UserCredentials returns the credentials of the S3 key of the user, subuser keys are used only if the user has no key of its own
+func (rgw *RGWClient) UserCredentials(uid string) (*credentials.Credentials, error) {
+	return rgw.UserCredentialsWithContext(context.Background(), uid)
+}
+
+// UserCredentialsWithContext is the same as UserCredentials with a context to cancel the request
+func (rgw *RGWClient) UserCredentialsWithContext(ctx context.Context, uid string) (*credentials.Credentials, error) {
+	userInfo, err := rgw.GetUserInfoWithContext(ctx, uid, "false")
+	if err != nil {
+		return nil, err
+	}
+	if len(userInfo.Keys) == 0 {
+		return nil, fmt.Errorf("user %s has no S3 key", uid)
+	}
+
+	key := userInfo.Keys[0]
+	for _, k := range userInfo.Keys {
+		if k.User == userInfo.UserID {
+			key = k
+			break
+		}
+	}
+	return credentials.NewStaticCredentials(key.AccessKey, key.SecretKey, ""), nil
+}
+
+// FleetTargets returns all the buckets of the users as the targets of a FleetCleaner,
+// each of them with the credentials of its owner
+func (rgw *RGWClient) FleetTargets(uids ...string) ([]s3box.FleetTarget, error) {
+	return rgw.FleetTargetsWithContext(context.Background(), uids...)
+}
+
+// FleetTargetsWithContext is the same as FleetTargets with a context to cancel the request
+func (rgw *RGWClient) FleetTargetsWithContext(ctx context.Context, uids ...string) ([]s3box.FleetTarget, error) {
+	var targets []s3box.FleetTarget
+	for _, uid := range uids {
+		creds, err := rgw.UserCredentialsWithContext(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		buckets, err := rgw.GetBucketInfoWithContext(ctx, uid, "")
+		if err != nil {
+			return nil, fmt.Errorf("get buckets of user %s: %w", uid, err)
+		}
+		for _, bucket := range *buckets {
+			targets = append(targets, s3box.FleetTarget{
+				Owner:       uid,
+				Credentials: creds,
+				Bucket:      bucket.Bucket,
+			})
+		}
+	}
+	return targets, nil
+}
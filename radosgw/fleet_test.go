@@ -0,0 +1,52 @@
+package radosgw
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRGWClient_UserCredentials(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_UserCredentials", t, func() {
+		tests := []struct {
+			name    string
+			uid     string
+			wantErr bool
+		}{
+			{"UserCredentials should success", "testid", false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.UserCredentials(tt.uid)
+				So(err, ShouldBeNil)
+				So(got, ShouldNotBeNil)
+			})
+		}
+	})
+}
+
+func TestRGWClient_FleetTargets(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_FleetTargets", t, func() {
+		tests := []struct {
+			name    string
+			uids    []string
+			wantErr bool
+		}{
+			{"FleetTargets should success", []string{"testid", "testid2"}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.FleetTargets(tt.uids...)
+				So(err, ShouldBeNil)
+				for _, target := range got {
+					So(target.Credentials, ShouldNotBeNil)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package radosgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+
+	"github.com/regenttsui/s3box/utils"
+)
+
+// Sections of the metadata API, a bucket is backed up by both its bucket and bucket.instance entries
+const (
+	MetadataSectionUser           = "user"
+	MetadataSectionBucket         = "bucket"
+	MetadataSectionBucketInstance = "bucket.instance"
+)
+
+// defaultListMaxEntries is the page size of the listings if maxEntries is 0 or less
+const defaultListMaxEntries = 1000
+
+// MetadataEntry is a metadata entry of a section, Data is kept raw to be put back as it is
+type MetadataEntry struct {
+	Key   string          `json:"key"`
+	Ver   MetadataVersion `json:"ver"`
+	Mtime string          `json:"mtime"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type MetadataVersion struct {
+	Tag string `json:"tag"`
+	Ver int64  `json:"ver"`
+}
+
+// keyPage is a page of the listings of users and metadata keys
+type keyPage struct {
+	Keys      []string `json:"keys"`
+	Truncated bool     `json:"truncated"`
+	Count     int64    `json:"count"`
+	Marker    string   `json:"marker"`
+}
+
+// ListUsers iterates over the ids of all the users by /admin/user?list, maxEntries users are listed a request.
+// The iteration stops at the first error, which is yielded with an empty id.
+func (rgw *RGWClient) ListUsers(maxEntries int) iter.Seq2[string, error] {
+	return rgw.ListUsersWithContext(context.Background(), maxEntries)
+}
+
+// ListUsersWithContext is the same as ListUsers with a context to cancel the requests
+func (rgw *RGWClient) ListUsersWithContext(ctx context.Context, maxEntries int) iter.Seq2[string, error] {
+	return rgw.listKeys(ctx, fmt.Sprintf("%s/admin/user?list&", *rgw.config.Endpoint), maxEntries)
+}
+
+// ListMetadataKeys iterates over the keys of a metadata section, such as the ids of all the users of the user section.
+// maxEntries keys are listed a request. The iteration stops at the first error, which is yielded with an empty key.
+func (rgw *RGWClient) ListMetadataKeys(section string, maxEntries int) iter.Seq2[string, error] {
+	return rgw.ListMetadataKeysWithContext(context.Background(), section, maxEntries)
+}
+
+// ListMetadataKeysWithContext is the same as ListMetadataKeys with a context to cancel the requests
+func (rgw *RGWClient) ListMetadataKeysWithContext(ctx context.Context, section string, maxEntries int) iter.Seq2[string, error] {
+	return rgw.listKeys(ctx, fmt.Sprintf("%s/admin/metadata/%s?", *rgw.config.Endpoint, section), maxEntries)
+}
+
+// listKeys iterates over the keys of the pages of a listing, baseURL ends with "?" or "&" to which
+// max-entries and marker are appended
+func (rgw *RGWClient) listKeys(ctx context.Context, baseURL string, maxEntries int) iter.Seq2[string, error] {
+	if maxEntries <= 0 {
+		maxEntries = defaultListMaxEntries
+	}
+	return func(yield func(string, error) bool) {
+		marker := ""
+		for {
+			page, err := rgw.listKeyPage(ctx, baseURL, marker, maxEntries)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			for _, key := range page.Keys {
+				if !yield(key, nil) {
+					return
+				}
+			}
+			if !page.Truncated || page.Marker == "" || page.Marker == marker {
+				return
+			}
+			marker = page.Marker
+		}
+	}
+}
+
+func (rgw *RGWClient) listKeyPage(ctx context.Context, baseURL, marker string, maxEntries int) (*keyPage, error) {
+	v := url.Values{}
+	v.Set("max-entries", fmt.Sprint(maxEntries))
+	if marker != "" {
+		v.Set("marker", marker)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+v.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buff, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var page keyPage
+	err = json.Unmarshal(buff, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, err
+}
+
+// GetMetadata returns the metadata entry of the key in the section
+func (rgw *RGWClient) GetMetadata(section, key string) (*MetadataEntry, error) {
+	return rgw.GetMetadataWithContext(context.Background(), section, key)
+}
+
+// GetMetadataWithContext is the same as GetMetadata with a context to cancel the request
+func (rgw *RGWClient) GetMetadataWithContext(ctx context.Context, section, key string) (*MetadataEntry, error) {
+	if section == "" || key == "" {
+		return nil, errors.New("section and key are required")
+	}
+
+	url := fmt.Sprintf("%s/admin/metadata/%s?key=%s", *rgw.config.Endpoint, section, url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buff, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry MetadataEntry
+	err = json.Unmarshal(buff, &entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, err
+}
+
+// PutMetadata creates or overwrites the metadata entry of the key in the section, such as one got from another cluster
+func (rgw *RGWClient) PutMetadata(section, key string, entry *MetadataEntry) error {
+	return rgw.PutMetadataWithContext(context.Background(), section, key, entry)
+}
+
+// PutMetadataWithContext is the same as PutMetadata with a context to cancel the request
+func (rgw *RGWClient) PutMetadataWithContext(ctx context.Context, section, key string, entry *MetadataEntry) error {
+	if section == "" || key == "" {
+		return errors.New("section and key are required")
+	}
+	buff, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	body := bytes.NewReader(buff)
+	url := fmt.Sprintf("%s/admin/metadata/%s?key=%s", *rgw.config.Endpoint, section, url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
+	if err != nil {
+		return err
+	}
+
+	err = utils.SetContentLengthHeader(req, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, body, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readResponse(resp)
+	return err
+}
+
+// DeleteMetadata deletes the metadata entry of the key in the section
+func (rgw *RGWClient) DeleteMetadata(section, key string) error {
+	return rgw.DeleteMetadataWithContext(context.Background(), section, key)
+}
+
+// DeleteMetadataWithContext is the same as DeleteMetadata with a context to cancel the request
+func (rgw *RGWClient) DeleteMetadataWithContext(ctx context.Context, section, key string) error {
+	if section == "" || key == "" {
+		return errors.New("section and key are required")
+	}
+
+	url := fmt.Sprintf("%s/admin/metadata/%s?key=%s", *rgw.config.Endpoint, section, url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, nil, false)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readResponse(resp)
+	return err
+}
@@ -0,0 +1,180 @@
+package radosgw
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestRGWClient_ListUsers(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_ListUsers", t, func() {
+		tests := []struct {
+			name       string
+			maxEntries int
+			want       string
+			wantErr    bool
+		}{
+			{"ListUsers should success", 0, "testid", false},
+			{"ListUsers by small pages should success", 1, "testid", false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				var got []string
+				for uid, err := range rgw.ListUsers(tt.maxEntries) {
+					So(err, ShouldBeNil)
+					got = append(got, uid)
+				}
+				So(got, ShouldContain, tt.want)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_ListMetadataKeys(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_ListMetadataKeys", t, func() {
+		tests := []struct {
+			name    string
+			section string
+			want    string
+			wantErr bool
+		}{
+			{"ListMetadataKeys of users should success", MetadataSectionUser, "testid", false},
+			{"ListMetadataKeys of buckets should success", MetadataSectionBucket, "test-bkt", false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				var got []string
+				for key, err := range rgw.ListMetadataKeys(tt.section, 0) {
+					So(err, ShouldBeNil)
+					got = append(got, key)
+				}
+				So(got, ShouldContain, tt.want)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_Metadata(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_Metadata", t, func() {
+		tests := []struct {
+			name    string
+			section string
+			key     string
+			wantErr bool
+		}{
+			{"user metadata should be put back", MetadataSectionUser, "testid", false},
+			{"bucket metadata should be put back", MetadataSectionBucket, "test-bkt", false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.GetMetadata(tt.section, tt.key)
+				So(err, ShouldBeNil)
+				So(got, ShouldNotBeNil)
+				So(rgw.PutMetadata(tt.section, tt.key, got), ShouldBeNil)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_listKeys(t *testing.T) {
+	Convey("TestRGWClient_listKeys", t, func() {
+		pages := map[string]string{
+			"":   `{"keys":["u1","u2"],"truncated":true,"count":2,"marker":"m1"}`,
+			"m1": `{"keys":["u3"],"truncated":false,"count":1,"marker":""}`,
+		}
+		var paths, queries []string
+		rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			paths = append(paths, req.URL.Path)
+			queries = append(queries, req.URL.RawQuery)
+			page, ok := pages[req.URL.Query().Get("marker")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"Code":"NoSuchKey"}`)
+				return
+			}
+			io.WriteString(w, page)
+		}))
+
+		Convey("ListUsers should follow the markers", func() {
+			var got []string
+			for uid, err := range rgw.ListUsers(2) {
+				So(err, ShouldBeNil)
+				got = append(got, uid)
+			}
+			So(got, ShouldResemble, []string{"u1", "u2", "u3"})
+			So(paths, ShouldResemble, []string{"/admin/user", "/admin/user"})
+			So(queries, ShouldResemble, []string{"list&max-entries=2", "list&marker=m1&max-entries=2"})
+		})
+
+		Convey("ListMetadataKeys should stop when the consumer stops", func() {
+			var got []string
+			for key, err := range rgw.ListMetadataKeys(MetadataSectionUser, 0) {
+				So(err, ShouldBeNil)
+				got = append(got, key)
+				break
+			}
+			So(got, ShouldResemble, []string{"u1"})
+			So(paths, ShouldResemble, []string{"/admin/metadata/user"})
+			So(queries, ShouldResemble, []string{"max-entries=1000"})
+		})
+
+		Convey("error should be yielded", func() {
+			pages["m1"] = `not json`
+			var got []string
+			var gotErr error
+			for key, err := range rgw.ListUsers(2) {
+				if err != nil {
+					gotErr = err
+					continue
+				}
+				got = append(got, key)
+			}
+			So(got, ShouldResemble, []string{"u1", "u2"})
+			So(gotErr, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRGWClient_metadataRequests(t *testing.T) {
+	Convey("TestRGWClient_metadataRequests", t, func() {
+		entry := `{"key":"user:testid","ver":{"tag":"_tag","ver":3},"mtime":"2024-01-01 10:00:00.000000Z","data":{"user_id":"testid"}}`
+		var method, rawQuery, body string
+		rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			buff, _ := io.ReadAll(req.Body)
+			method, rawQuery, body = req.Method, req.URL.RawQuery, string(buff)
+			if req.Method == "GET" {
+				io.WriteString(w, entry)
+			}
+		}))
+
+		got, err := rgw.GetMetadata(MetadataSectionBucketInstance, "bkt:instance")
+		So(err, ShouldBeNil)
+		So(method, ShouldEqual, "GET")
+		So(rawQuery, ShouldEqual, "key=bkt%3Ainstance")
+		So(got.Ver.Ver, ShouldEqual, 3)
+
+		So(rgw.PutMetadata(MetadataSectionUser, "testid", got), ShouldBeNil)
+		So(method, ShouldEqual, "PUT")
+		var put MetadataEntry
+		So(json.Unmarshal([]byte(body), &put), ShouldBeNil)
+		So(string(put.Data), ShouldEqual, `{"user_id":"testid"}`)
+
+		So(rgw.DeleteMetadata(MetadataSectionUser, "testid"), ShouldBeNil)
+		So(method, ShouldEqual, "DELETE")
+		So(rawQuery, ShouldEqual, "key=testid")
+	})
+}
@@ -1,10 +1,10 @@
 package radosgw
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 
@@ -16,21 +16,6 @@ type (
 	TagFilter      map[string]string
 )
 
-// ErrorResponse represents an AWS S3/RGW error response
-// Format: <Error><Code>...</Code><Message>...</Message><Resource>...</Resource><RequestId>...</RequestId></Error>
-type ErrorResponse struct {
-	XMLName   xml.Name `xml:"Error"`
-	Text      string   `xml:",chardata"`
-	Code      string   `xml:"Code"`
-	Message   string   `xml:"Message"`
-	Resource  string   `xml:"Resource"`
-	RequestId string   `xml:"RequestId"`
-}
-
-func (e *ErrorResponse) Error() string {
-	return fmt.Sprintf("%s: %s (RequestId: %s)", e.Code, e.Message, e.RequestId)
-}
-
 type ListTopicsResponse struct {
 	XMLName          xml.Name `xml:"ListTopicsResponse"`
 	Text             string   `xml:",chardata"`
@@ -140,14 +125,19 @@ type NotificationConfiguration struct {
 }
 
 func (rgw *RGWClient) ListTopics() (*ListTopicsResponse, error) {
+	return rgw.ListTopicsWithContext(context.Background())
+}
+
+// ListTopicsWithContext is the same as ListTopics with a context to cancel the request
+func (rgw *RGWClient) ListTopicsWithContext(ctx context.Context) (*ListTopicsResponse, error) {
 	body := strings.NewReader("Action=ListTopics&Version=2010-03-31")
 	url := fmt.Sprintf("%s/", *rgw.config.Endpoint)
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, body, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -155,20 +145,11 @@ func (rgw *RGWClient) ListTopics() (*ListTopicsResponse, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check HTTP status code
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errResp ErrorResponse
-		if err := xml.Unmarshal(buff, &errResp); err == nil && errResp.Code != "" {
-			return nil, &errResp
-		}
-		return nil, fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, string(buff))
-	}
-
 	var topics ListTopicsResponse
 	err = xml.Unmarshal(buff, &topics)
 	if err != nil {
@@ -179,14 +160,19 @@ func (rgw *RGWClient) ListTopics() (*ListTopicsResponse, error) {
 }
 
 func (rgw *RGWClient) CreateTopic(topicName, pushEndpoint string) (string, error) {
-	body := fmt.Sprintf("Action=CreateTopic&Version=2010-03-31&Name=%s&push-endpoint=%s", topicName, pushEndpoint)
+	return rgw.CreateTopicWithContext(context.Background(), topicName, pushEndpoint)
+}
+
+// CreateTopicWithContext is the same as CreateTopic with a context to cancel the request
+func (rgw *RGWClient) CreateTopicWithContext(ctx context.Context, topicName, pushEndpoint string) (string, error) {
+	body := strings.NewReader(fmt.Sprintf("Action=CreateTopic&Version=2010-03-31&Name=%s&push-endpoint=%s", topicName, pushEndpoint))
 	url := fmt.Sprintf("%s/", *rgw.config.Endpoint)
-	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return "", err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, body, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -194,20 +180,11 @@ func (rgw *RGWClient) CreateTopic(topicName, pushEndpoint string) (string, error
 		return "", err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return "", err
 	}
 
-	// Check HTTP status code
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errResp ErrorResponse
-		if err := xml.Unmarshal(buff, &errResp); err == nil && errResp.Code != "" {
-			return "", &errResp
-		}
-		return "", fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, string(buff))
-	}
-
 	var topic CreateTopicResponse
 	err = xml.Unmarshal(buff, &topic)
 	if err != nil {
@@ -218,14 +195,20 @@ func (rgw *RGWClient) CreateTopic(topicName, pushEndpoint string) (string, error
 }
 
 func (rgw *RGWClient) GetTopic(topicArn string) (*GetTopicResponse, error) {
-	body := fmt.Sprintf("Action=GetTopic&Version=2010-03-31&TopicArn=%s", topicArn)
+	return rgw.GetTopicWithContext(context.Background(), topicArn)
+}
+
+// GetTopicWithContext is the same as GetTopic with a context to cancel the request.
+// An *ErrorResponse with StatusCode 404 is returned if the topic does not exist.
+func (rgw *RGWClient) GetTopicWithContext(ctx context.Context, topicArn string) (*GetTopicResponse, error) {
+	body := strings.NewReader(fmt.Sprintf("Action=GetTopic&Version=2010-03-31&TopicArn=%s", topicArn))
 	url := fmt.Sprintf("%s/", *rgw.config.Endpoint)
-	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, body, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -233,24 +216,11 @@ func (rgw *RGWClient) GetTopic(topicArn string) (*GetTopicResponse, error) {
 		return nil, err
 	}
 
-	if resp.StatusCode == 404 {
-		return nil, nil
-	}
-
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check HTTP status code for other errors
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errResp ErrorResponse
-		if err := xml.Unmarshal(buff, &errResp); err == nil && errResp.Code != "" {
-			return nil, &errResp
-		}
-		return nil, fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, string(buff))
-	}
-
 	var topic GetTopicResponse
 	err = xml.Unmarshal(buff, &topic)
 	if err != nil {
@@ -261,38 +231,61 @@ func (rgw *RGWClient) GetTopic(topicArn string) (*GetTopicResponse, error) {
 }
 
 func (rgw *RGWClient) DeleteTopic(topicArn string) (*http.Response, error) {
-	body := fmt.Sprintf("Action=DeleteTopic&Version=2010-03-31&TopicArn=%s", topicArn)
+	return rgw.DeleteTopicWithContext(context.Background(), topicArn)
+}
+
+// DeleteTopicWithContext is the same as DeleteTopic with a context to cancel the request
+func (rgw *RGWClient) DeleteTopicWithContext(ctx context.Context, topicArn string) (*http.Response, error) {
+	body := strings.NewReader(fmt.Sprintf("Action=DeleteTopic&Version=2010-03-31&TopicArn=%s", topicArn))
 	url := fmt.Sprintf("%s/", *rgw.config.Endpoint)
-	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, body, true)
+	if err != nil {
+		return nil, err
+	}
 
-	return resp, err
+	return resp, checkResponse(resp)
 }
 
 // CreateNotification TODO Support tag and regular expression filtering
 func (rgw *RGWClient) CreateNotification(topicArn, bucket, notificationId, prefix, suffix string, metaData MetaDataFilter, events []string) (*http.Response, error) {
-	body, err := rgw.buildNotificationBody(topicArn, notificationId, prefix, suffix, metaData, events)
+	return rgw.CreateNotificationWithContext(context.Background(), topicArn, bucket, notificationId, prefix, suffix, metaData, events)
+}
+
+// CreateNotificationWithContext is the same as CreateNotification with a context to cancel the request
+func (rgw *RGWClient) CreateNotificationWithContext(ctx context.Context, topicArn, bucket, notificationId, prefix, suffix string, metaData MetaDataFilter, events []string) (*http.Response, error) {
+	notification, err := rgw.buildNotificationBody(topicArn, notificationId, prefix, suffix, metaData, events)
 	if err != nil {
 		return nil, err
 	}
 
+	body := strings.NewReader(notification)
 	url := fmt.Sprintf("%s/%s?notification", *rgw.config.Endpoint, bucket)
-	req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, body, true)
+	if err != nil {
+		return nil, err
+	}
 
-	return resp, err
+	return resp, checkResponse(resp)
 }
 
 // GetNotification TODO define a struct to hold response for easier use by the client
 func (rgw *RGWClient) GetNotification(bucket, notificationId string) (*NotificationConfiguration, error) {
+	return rgw.GetNotificationWithContext(context.Background(), bucket, notificationId)
+}
+
+// GetNotificationWithContext is the same as GetNotification with a context to cancel the request.
+// An *ErrorResponse with StatusCode 404 is returned if the notification does not exist.
+func (rgw *RGWClient) GetNotificationWithContext(ctx context.Context, bucket, notificationId string) (*NotificationConfiguration, error) {
 	if bucket == "" {
 		err := errors.New("bucket can not be empty")
 		return nil, err
@@ -302,12 +295,12 @@ func (rgw *RGWClient) GetNotification(bucket, notificationId string) (*Notificat
 	if notificationId != "" {
 		url += "=" + notificationId
 	}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -315,24 +308,11 @@ func (rgw *RGWClient) GetNotification(bucket, notificationId string) (*Notificat
 		return nil, err
 	}
 
-	if resp.StatusCode == 404 {
-		return nil, nil
-	}
-
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check HTTP status code for other errors
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var errResp ErrorResponse
-		if err := xml.Unmarshal(buff, &errResp); err == nil && errResp.Code != "" {
-			return nil, &errResp
-		}
-		return nil, fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, string(buff))
-	}
-
 	var notif NotificationConfiguration
 	err = xml.Unmarshal(buff, &notif)
 	if err != nil {
@@ -343,15 +323,23 @@ func (rgw *RGWClient) GetNotification(bucket, notificationId string) (*Notificat
 }
 
 func (rgw *RGWClient) DeleteNotification(bucket, notificationId string) (*http.Response, error) {
+	return rgw.DeleteNotificationWithContext(context.Background(), bucket, notificationId)
+}
+
+// DeleteNotificationWithContext is the same as DeleteNotification with a context to cancel the request
+func (rgw *RGWClient) DeleteNotificationWithContext(ctx context.Context, bucket, notificationId string) (*http.Response, error) {
 	url := fmt.Sprintf("%s/%s?notification=%s", *rgw.config.Endpoint, bucket, notificationId)
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
+	if err != nil {
+		return nil, err
+	}
 
-	return resp, err
+	return resp, checkResponse(resp)
 }
 
 // TODO Support tag and regular expression filtering
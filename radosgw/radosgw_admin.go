@@ -1,10 +1,11 @@
 package radosgw
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 
 	"github.com/google/go-querystring/query"
@@ -54,19 +55,109 @@ type Subuser struct {
 	Permissions string `json:"permissions"`
 }
 
+// SubuserAccess is the access level of a subuser
+type SubuserAccess string
+
+const (
+	SubuserAccessRead      SubuserAccess = "read"
+	SubuserAccessWrite     SubuserAccess = "write"
+	SubuserAccessReadWrite SubuserAccess = "readwrite"
+	SubuserAccessFull      SubuserAccess = "full"
+)
+
+// Key types of UserConf and SubuserConf
+const (
+	KeyTypeS3    = "s3"
+	KeyTypeSwift = "swift"
+)
+
+type SubuserConf struct {
+	Uid string `url:"uid,omitempty"`
+	// Subuser is the name of the subuser, with or without the "uid:" prefix
+	Subuser   string        `url:"subuser,omitempty"`
+	SecretKey string        `url:"secret-key,omitempty"`
+	KeyType   string        `url:"key-type,omitempty"`
+	Access    SubuserAccess `url:"access,omitempty"`
+	// GenerateSecret generates a secret key if SecretKey is empty
+	GenerateSecret bool `url:"generate-secret,omitempty"`
+	// PurgeKeys is only used by RemoveSubuser, the keys of the subuser are removed if it is nil as RGW does by default
+	PurgeKeys *bool `url:"purge-keys,omitempty"`
+}
+
+func (c *SubuserConf) validate() error {
+	if c.Uid == "" {
+		return errors.New("uid is required")
+	}
+	if c.Subuser == "" {
+		return errors.New("subuser is required")
+	}
+	switch c.Access {
+	case "", SubuserAccessRead, SubuserAccessWrite, SubuserAccessReadWrite, SubuserAccessFull:
+	default:
+		return fmt.Errorf("invalid subuser access %q", c.Access)
+	}
+	switch c.KeyType {
+	case "", KeyTypeS3, KeyTypeSwift:
+	default:
+		return fmt.Errorf("invalid key type %q", c.KeyType)
+	}
+	return nil
+}
+
 type Capability struct {
 	Type string `json:"type"`
 	Perm string `json:"perm"`
 }
 
+// Unlimited is the value of a quota limit which does not limit anything
+const Unlimited int64 = -1
+
+// Quota is a user or bucket quota. MaxSize is in bytes and MaxSizeKB is in KiB, only one of them needs to be set,
+// the other one is derived from it when it is 0. Set a limit to Unlimited to lift it.
 type Quota struct {
-	Enabled    bool  `json:"enabled"`
-	CheckOnRaw bool  `json:"check_on_raw"`
-	MaxSize    int64 `json:"max_size"`
-	MaxSizeKB  int64 `json:"max_size_kb"`
+	Enabled    bool `json:"enabled"`
+	CheckOnRaw bool `json:"check_on_raw"`
+	// MaxSize and MaxSizeKB are a limit of 0 bytes when both of them are 0
+	MaxSize   int64 `json:"max_size"`
+	MaxSizeKB int64 `json:"max_size_kb"`
+	// MaxObjects is a limit of 0 objects when it is 0
 	MaxObjects int64 `json:"max_objects"`
 }
 
+// ErrInvalidQuota is wrapped by the errors of invalid quotas
+var ErrInvalidQuota = errors.New("invalid quota")
+
+// Validate checks the limits are Unlimited or more, and MaxSize agrees with MaxSizeKB if both are set
+func (q *Quota) Validate() error {
+	switch {
+	case q.MaxSize < Unlimited:
+		return fmt.Errorf("%w: max size %d is less than %d", ErrInvalidQuota, q.MaxSize, Unlimited)
+	case q.MaxSizeKB < Unlimited:
+		return fmt.Errorf("%w: max size kb %d is less than %d", ErrInvalidQuota, q.MaxSizeKB, Unlimited)
+	case q.MaxObjects < Unlimited:
+		return fmt.Errorf("%w: max objects %d is less than %d", ErrInvalidQuota, q.MaxObjects, Unlimited)
+	}
+	if q.MaxSize != 0 && q.MaxSizeKB != 0 && q.normalized().MaxSizeKB != q.MaxSizeKB {
+		return fmt.Errorf("%w: max size %d conflicts with max size kb %d", ErrInvalidQuota, q.MaxSize, q.MaxSizeKB)
+	}
+	return nil
+}
+
+// normalized returns a copy of the quota with both MaxSize and MaxSizeKB set from the one which is set
+func (q *Quota) normalized() Quota {
+	n := *q
+	switch {
+	case n.MaxSize == 0 && n.MaxSizeKB == 0:
+	case n.MaxSize == Unlimited || n.MaxSizeKB == Unlimited:
+		n.MaxSize, n.MaxSizeKB = Unlimited, Unlimited
+	case n.MaxSize == 0:
+		n.MaxSize = n.MaxSizeKB * 1024
+	default:
+		n.MaxSizeKB = (n.MaxSize + 1023) / 1024
+	}
+	return n
+}
+
 type KeyClass struct {
 	User      string `json:"user"`
 	AccessKey string `json:"access_key"`
@@ -121,65 +212,120 @@ type RGWMain struct {
 	NumObjects     int64 `json:"num_objects"`
 }
 
-func (rgw *RGWClient) PutUserQuota(uid string, body io.ReadSeeker) (*http.Response, error) {
+// PutUserQuota sets the quota of all the buckets of the user in total
+func (rgw *RGWClient) PutUserQuota(uid string, quota *Quota) error {
+	return rgw.PutUserQuotaWithContext(context.Background(), uid, quota)
+}
+
+// PutUserQuotaWithContext is the same as PutUserQuota with a context to cancel the request
+func (rgw *RGWClient) PutUserQuotaWithContext(ctx context.Context, uid string, quota *Quota) error {
 	url := fmt.Sprintf("%s/admin/user?quota&uid=%s&quota-type=user", *rgw.config.Endpoint, uid)
-	req, err := http.NewRequest("PUT", url, body)
+	return rgw.putQuota(ctx, url, quota)
+}
+
+// PutUserBucketQuota sets the quota of every bucket of the user
+func (rgw *RGWClient) PutUserBucketQuota(uid string, quota *Quota) error {
+	return rgw.PutUserBucketQuotaWithContext(context.Background(), uid, quota)
+}
+
+// PutUserBucketQuotaWithContext is the same as PutUserBucketQuota with a context to cancel the request
+func (rgw *RGWClient) PutUserBucketQuotaWithContext(ctx context.Context, uid string, quota *Quota) error {
+	url := fmt.Sprintf("%s/admin/user?quota&uid=%s&quota-type=bucket", *rgw.config.Endpoint, uid)
+	return rgw.putQuota(ctx, url, quota)
+}
+
+// PutBucketQuota sets the quota of a bucket of the user
+func (rgw *RGWClient) PutBucketQuota(uid, bucketName string, quota *Quota) error {
+	return rgw.PutBucketQuotaWithContext(context.Background(), uid, bucketName, quota)
+}
+
+// PutBucketQuotaWithContext is the same as PutBucketQuota with a context to cancel the request
+func (rgw *RGWClient) PutBucketQuotaWithContext(ctx context.Context, uid, bucketName string, quota *Quota) error {
+	url := fmt.Sprintf("%s/admin/bucket?quota&uid=%s&bucket=%s", *rgw.config.Endpoint, uid, bucketName)
+	return rgw.putQuota(ctx, url, quota)
+}
+
+// putQuota validates the quota and puts it to url
+func (rgw *RGWClient) putQuota(ctx context.Context, url string, quota *Quota) error {
+	if quota == nil {
+		return fmt.Errorf("%w: quota is required", ErrInvalidQuota)
+	}
+	if err := quota.Validate(); err != nil {
+		return err
+	}
+	buff, err := json.Marshal(quota.normalized())
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	body := bytes.NewReader(buff)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
+	if err != nil {
+		return err
 	}
 
 	err = utils.SetContentLengthHeader(req, body)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, body, true)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	_, err = readResponse(resp)
+	return err
+}
 
-	return resp, err
+func (rgw *RGWClient) GetUserQuota(uid string) (*Quota, error) {
+	return rgw.GetUserQuotaWithContext(context.Background(), uid)
 }
 
-func (rgw *RGWClient) PutUserBucketQuota(uid string, body io.ReadSeeker) (*http.Response, error) {
-	url := fmt.Sprintf("%s/admin/user?quota&uid=%s&quota-type=bucket", *rgw.config.Endpoint, uid)
-	req, err := http.NewRequest("PUT", url, body)
+// GetUserQuotaWithContext is the same as GetUserQuota with a context to cancel the request
+func (rgw *RGWClient) GetUserQuotaWithContext(ctx context.Context, uid string) (*Quota, error) {
+	url := fmt.Sprintf("%s/admin/user?quota&uid=%s&quota-type=user", *rgw.config.Endpoint, uid)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	err = utils.SetContentLengthHeader(req, body)
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
-
-	return resp, err
-}
-
-func (rgw *RGWClient) PutBucketQuota(uid, bucketName string, body io.ReadSeeker) (*http.Response, error) {
-	url := fmt.Sprintf("%s/admin/bucket?quota&uid=%s&bucket=%s", *rgw.config.Endpoint, uid, bucketName)
-	req, err := http.NewRequest("PUT", url, body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	err = utils.SetContentLengthHeader(req, body)
+	var quota Quota
+	err = json.Unmarshal(buff, &quota)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	return &quota, err
+}
 
-	return resp, err
+func (rgw *RGWClient) GetUserBucketQuota(uid string) (*Quota, error) {
+	return rgw.GetUserBucketQuotaWithContext(context.Background(), uid)
 }
 
-func (rgw *RGWClient) GetUserQuota(uid string) (*Quota, error) {
-	url := fmt.Sprintf("%s/admin/user?quota&uid=%s&quota-type=user", *rgw.config.Endpoint, uid)
-	req, err := http.NewRequest("GET", url, nil)
+// GetUserBucketQuotaWithContext is the same as GetUserBucketQuota with a context to cancel the request
+func (rgw *RGWClient) GetUserBucketQuotaWithContext(ctx context.Context, uid string) (*Quota, error) {
+	url := fmt.Sprintf("%s/admin/user?quota&uid=%s&quota-type=bucket", *rgw.config.Endpoint, uid)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -187,7 +333,7 @@ func (rgw *RGWClient) GetUserQuota(uid string) (*Quota, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -201,14 +347,30 @@ func (rgw *RGWClient) GetUserQuota(uid string) (*Quota, error) {
 	return &quota, err
 }
 
-func (rgw *RGWClient) GetUserBucketQuota(uid string) (*Quota, error) {
-	url := fmt.Sprintf("%s/admin/user?quota&uid=%s&quota-type=bucket", *rgw.config.Endpoint, uid)
-	req, err := http.NewRequest("GET", url, nil)
+// bucketQuotaConf is the query of GetBucketQuota
+type bucketQuotaConf struct {
+	Bucket string `url:"bucket"`
+}
+
+// GetBucketQuota returns the quota of a bucket, which is set by PutBucketQuota
+func (rgw *RGWClient) GetBucketQuota(bucketName string) (*Quota, error) {
+	return rgw.GetBucketQuotaWithContext(context.Background(), bucketName)
+}
+
+// GetBucketQuotaWithContext is the same as GetBucketQuota with a context to cancel the request
+func (rgw *RGWClient) GetBucketQuotaWithContext(ctx context.Context, bucketName string) (*Quota, error) {
+	if bucketName == "" {
+		return nil, errors.New("bucket is required")
+	}
+
+	v, _ := query.Values(&bucketQuotaConf{Bucket: bucketName})
+	url := fmt.Sprintf("%s/admin/bucket?%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -216,30 +378,34 @@ func (rgw *RGWClient) GetUserBucketQuota(uid string) (*Quota, error) {
 		return nil, err
 	}
 
-	//TODO handle not 200 response
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	var quota Quota
-	err = json.Unmarshal(buff, &quota)
+	var bucketInfo BucketInfoElement
+	err = json.Unmarshal(buff, &bucketInfo)
 	if err != nil {
 		return nil, err
 	}
 
-	return &quota, err
+	return &bucketInfo.BucketQuota, err
 }
 
-// GetBucketInfo aka GetBucketQuota/GetBucketStats
+// GetBucketInfo aka GetBucketStats
 func (rgw *RGWClient) GetBucketInfo(uid, bucketName string) (*BucketInfo, error) {
+	return rgw.GetBucketInfoWithContext(context.Background(), uid, bucketName)
+}
+
+// GetBucketInfoWithContext is the same as GetBucketInfo with a context to cancel the request
+func (rgw *RGWClient) GetBucketInfoWithContext(ctx context.Context, uid, bucketName string) (*BucketInfo, error) {
 	url := fmt.Sprintf("%s/admin/bucket?uid=%s&bucket=%s&stats=True", *rgw.config.Endpoint, uid, bucketName)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -247,7 +413,7 @@ func (rgw *RGWClient) GetBucketInfo(uid, bucketName string) (*BucketInfo, error)
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -263,13 +429,18 @@ func (rgw *RGWClient) GetBucketInfo(uid, bucketName string) (*BucketInfo, error)
 
 // GetUserInfo stats should be "True" or "False"
 func (rgw *RGWClient) GetUserInfo(uid, stats string) (*UserInfo, error) {
+	return rgw.GetUserInfoWithContext(context.Background(), uid, stats)
+}
+
+// GetUserInfoWithContext is the same as GetUserInfo with a context to cancel the request
+func (rgw *RGWClient) GetUserInfoWithContext(ctx context.Context, uid, stats string) (*UserInfo, error) {
 	url := fmt.Sprintf("%s/admin/user?uid=%s&stats=%s", *rgw.config.Endpoint, uid, stats)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -277,7 +448,7 @@ func (rgw *RGWClient) GetUserInfo(uid, stats string) (*UserInfo, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -292,6 +463,11 @@ func (rgw *RGWClient) GetUserInfo(uid, stats string) (*UserInfo, error) {
 }
 
 func (rgw *RGWClient) CreateUser(userConf *UserConf) (*UserInfo, error) {
+	return rgw.CreateUserWithContext(context.Background(), userConf)
+}
+
+// CreateUserWithContext is the same as CreateUser with a context to cancel the request
+func (rgw *RGWClient) CreateUserWithContext(ctx context.Context, userConf *UserConf) (*UserInfo, error) {
 	if userConf.Uid == "" {
 		return nil, errors.New("uid is required")
 	}
@@ -301,12 +477,12 @@ func (rgw *RGWClient) CreateUser(userConf *UserConf) (*UserInfo, error) {
 
 	v, _ := query.Values(userConf)
 	url := fmt.Sprintf("%s/admin/user?%s", *rgw.config.Endpoint, v.Encode())
-	req, err := http.NewRequest("PUT", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, false)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -314,7 +490,7 @@ func (rgw *RGWClient) CreateUser(userConf *UserConf) (*UserInfo, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -329,18 +505,23 @@ func (rgw *RGWClient) CreateUser(userConf *UserConf) (*UserInfo, error) {
 }
 
 func (rgw *RGWClient) ModifyUser(userConf *UserConf) (*UserInfo, error) {
+	return rgw.ModifyUserWithContext(context.Background(), userConf)
+}
+
+// ModifyUserWithContext is the same as ModifyUser with a context to cancel the request
+func (rgw *RGWClient) ModifyUserWithContext(ctx context.Context, userConf *UserConf) (*UserInfo, error) {
 	if userConf.Uid == "" {
 		return nil, errors.New("uid is required")
 	}
 
 	v, _ := query.Values(userConf)
 	url := fmt.Sprintf("%s/admin/user?%s", *rgw.config.Endpoint, v.Encode())
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, !userConf.GenerateKey)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -348,7 +529,7 @@ func (rgw *RGWClient) ModifyUser(userConf *UserConf) (*UserInfo, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -363,34 +544,47 @@ func (rgw *RGWClient) ModifyUser(userConf *UserConf) (*UserInfo, error) {
 }
 
 func (rgw *RGWClient) RemoveUser(uid string) (*http.Response, error) {
+	return rgw.RemoveUserWithContext(context.Background(), uid)
+}
+
+// RemoveUserWithContext is the same as RemoveUser with a context to cancel the request
+func (rgw *RGWClient) RemoveUserWithContext(ctx context.Context, uid string) (*http.Response, error) {
 	if uid == "" {
 		return nil, errors.New("uid is required")
 	}
 
 	url := fmt.Sprintf("%s/admin/user?uid=%s", *rgw.config.Endpoint, uid)
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, false)
+	if err != nil {
+		return nil, err
+	}
 
-	return resp, err
+	return resp, checkResponse(resp)
 }
 
 func (rgw *RGWClient) CreateKey(userConf *UserConf) (*[]KeyClass, error) {
+	return rgw.CreateKeyWithContext(context.Background(), userConf)
+}
+
+// CreateKeyWithContext is the same as CreateKey with a context to cancel the request
+func (rgw *RGWClient) CreateKeyWithContext(ctx context.Context, userConf *UserConf) (*[]KeyClass, error) {
 	if userConf.Uid == "" {
 		return nil, errors.New("uid is required")
 	}
 
 	v, _ := query.Values(userConf)
 	url := fmt.Sprintf("%s/admin/user?key&%s", *rgw.config.Endpoint, v.Encode())
-	req, err := http.NewRequest("PUT", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, false)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -398,7 +592,7 @@ func (rgw *RGWClient) CreateKey(userConf *UserConf) (*[]KeyClass, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -413,34 +607,138 @@ func (rgw *RGWClient) CreateKey(userConf *UserConf) (*[]KeyClass, error) {
 }
 
 func (rgw *RGWClient) RemoveKey(userConf *UserConf) (*http.Response, error) {
+	return rgw.RemoveKeyWithContext(context.Background(), userConf)
+}
+
+// RemoveKeyWithContext is the same as RemoveKey with a context to cancel the request
+func (rgw *RGWClient) RemoveKeyWithContext(ctx context.Context, userConf *UserConf) (*http.Response, error) {
 	if userConf.AccessKey == "" {
 		return nil, errors.New("access-key is required")
 	}
 
 	v, _ := query.Values(userConf)
 	url := fmt.Sprintf("%s/admin/user?key&%s", *rgw.config.Endpoint, v.Encode())
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rgw.sendReq(req, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, checkResponse(resp)
+}
+
+// CreateSubuser creates a subuser of the user, it returns all the subusers of the user
+func (rgw *RGWClient) CreateSubuser(subuserConf *SubuserConf) ([]Subuser, error) {
+	return rgw.CreateSubuserWithContext(context.Background(), subuserConf)
+}
+
+// CreateSubuserWithContext is the same as CreateSubuser with a context to cancel the request
+func (rgw *RGWClient) CreateSubuserWithContext(ctx context.Context, subuserConf *SubuserConf) ([]Subuser, error) {
+	return rgw.putSubuser(ctx, "PUT", subuserConf, false)
+}
+
+// ModifySubuser modifies a subuser of the user, it returns all the subusers of the user
+func (rgw *RGWClient) ModifySubuser(subuserConf *SubuserConf) ([]Subuser, error) {
+	return rgw.ModifySubuserWithContext(context.Background(), subuserConf)
+}
+
+// ModifySubuserWithContext is the same as ModifySubuser with a context to cancel the request
+func (rgw *RGWClient) ModifySubuserWithContext(ctx context.Context, subuserConf *SubuserConf) ([]Subuser, error) {
+	return rgw.putSubuser(ctx, "POST", subuserConf, !subuserConf.GenerateSecret)
+}
+
+// putSubuser creates or modifies a subuser, which only differ in method
+func (rgw *RGWClient) putSubuser(ctx context.Context, method string, subuserConf *SubuserConf, idempotent bool) ([]Subuser, error) {
+	if err := subuserConf.validate(); err != nil {
+		return nil, err
+	}
+
+	conf := *subuserConf
+	conf.PurgeKeys = nil
+	v, _ := query.Values(&conf)
+	url := fmt.Sprintf("%s/admin/user?subuser&%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, idempotent)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return resp, err
+	buff, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var subusers []Subuser
+	err = json.Unmarshal(buff, &subusers)
+	if err != nil {
+		return nil, err
+	}
+
+	return subusers, err
+}
+
+// RemoveSubuser removes a subuser of the user, only Uid, Subuser and PurgeKeys of subuserConf are used
+func (rgw *RGWClient) RemoveSubuser(subuserConf *SubuserConf) error {
+	return rgw.RemoveSubuserWithContext(context.Background(), subuserConf)
+}
+
+// RemoveSubuserWithContext is the same as RemoveSubuser with a context to cancel the request
+func (rgw *RGWClient) RemoveSubuserWithContext(ctx context.Context, subuserConf *SubuserConf) error {
+	if err := subuserConf.validate(); err != nil {
+		return err
+	}
+
+	v, _ := query.Values(&SubuserConf{
+		Uid:       subuserConf.Uid,
+		Subuser:   subuserConf.Subuser,
+		PurgeKeys: subuserConf.PurgeKeys,
+	})
+	url := fmt.Sprintf("%s/admin/user?subuser&%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, nil, false)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readResponse(resp)
+	return err
 }
 
 func (rgw *RGWClient) AddCaps(uid, caps string) (*[]Capability, error) {
+	return rgw.AddCapsWithContext(context.Background(), uid, caps)
+}
+
+// AddCapsWithContext is the same as AddCaps with a context to cancel the request
+func (rgw *RGWClient) AddCapsWithContext(ctx context.Context, uid, caps string) (*[]Capability, error) {
 	if uid == "" {
 		return nil, errors.New("uid is required")
 	}
 
 	url := fmt.Sprintf("%s/admin/user?caps&uid=%s&user-caps=%s", *rgw.config.Endpoint, uid, caps)
-	req, err := http.NewRequest("PUT", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -448,7 +746,7 @@ func (rgw *RGWClient) AddCaps(uid, caps string) (*[]Capability, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -463,17 +761,22 @@ func (rgw *RGWClient) AddCaps(uid, caps string) (*[]Capability, error) {
 }
 
 func (rgw *RGWClient) RemoveCaps(uid, caps string) (*[]Capability, error) {
+	return rgw.RemoveCapsWithContext(context.Background(), uid, caps)
+}
+
+// RemoveCapsWithContext is the same as RemoveCaps with a context to cancel the request
+func (rgw *RGWClient) RemoveCapsWithContext(ctx context.Context, uid, caps string) (*[]Capability, error) {
 	if uid == "" {
 		return nil, errors.New("uid is required")
 	}
 
 	url := fmt.Sprintf("%s/admin/user?caps&uid=%s&user-caps=%s", *rgw.config.Endpoint, uid, caps)
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := rgw.buildSignerV2AndSendReq(req)
+	resp, err := rgw.sendReq(req, nil, true)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -481,7 +784,7 @@ func (rgw *RGWClient) RemoveCaps(uid, caps string) (*[]Capability, error) {
 		return nil, err
 	}
 
-	buff, err := io.ReadAll(resp.Body)
+	buff, err := readResponse(resp)
 	if err != nil {
 		return nil, err
 	}
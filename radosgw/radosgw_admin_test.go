@@ -1,9 +1,12 @@
 package radosgw
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
 	"testing"
 )
 
@@ -18,7 +21,7 @@ func TestRGWClient_PutUserQuota(t *testing.T) {
 		tests := []struct {
 			name    string
 			args    args
-			want    int
+			want    int64
 			wantErr bool
 		}{
 			{"PutUserQuota should success", args{"quota-user", Quota{
@@ -27,19 +30,19 @@ func TestRGWClient_PutUserQuota(t *testing.T) {
 				MaxSize:    -1,
 				MaxSizeKB:  0,
 				MaxObjects: -1,
-			}}, 200, false},
+			}}, -1, false},
 		}
 
 		for _, tt := range tests {
 			Convey(tt.name, func() {
-				var buf bytes.Buffer
-				err := json.NewEncoder(&buf).Encode(tt.args.quota)
+				err := rgw.PutUserQuota(tt.args.uid, &tt.args.quota)
 				So(err, ShouldBeNil)
 
-				got, err := rgw.PutUserQuota(tt.args.uid, bytes.NewReader(buf.Bytes()))
-				So(got, ShouldNotBeNil)
-				So(got.StatusCode, ShouldEqual, tt.want)
+				got, err := rgw.GetUserQuota(tt.args.uid)
 				So(err, ShouldBeNil)
+				So(got.Enabled, ShouldEqual, tt.args.quota.Enabled)
+				So(got.MaxObjects, ShouldEqual, tt.args.quota.MaxObjects)
+				So(got.MaxSize, ShouldEqual, tt.want)
 				t.Log(got)
 			})
 		}
@@ -57,7 +60,7 @@ func TestRGWClient_PutUserBucketQuota(t *testing.T) {
 		tests := []struct {
 			name    string
 			args    args
-			want    int
+			want    int64
 			wantErr bool
 		}{
 			{"PutUserBucketQuota should success", args{"quota-user", Quota{
@@ -65,19 +68,19 @@ func TestRGWClient_PutUserBucketQuota(t *testing.T) {
 				CheckOnRaw: false,
 				MaxSizeKB:  100,
 				MaxObjects: 100,
-			}}, 200, false},
+			}}, 100 * 1024, false},
 		}
 
 		for _, tt := range tests {
 			Convey(tt.name, func() {
-				var buf bytes.Buffer
-				err := json.NewEncoder(&buf).Encode(tt.args.quota)
+				err := rgw.PutUserBucketQuota(tt.args.uid, &tt.args.quota)
 				So(err, ShouldBeNil)
 
-				got, err := rgw.PutUserBucketQuota(tt.args.uid, bytes.NewReader(buf.Bytes()))
-				So(got, ShouldNotBeNil)
-				So(got.StatusCode, ShouldEqual, tt.want)
+				got, err := rgw.GetUserBucketQuota(tt.args.uid)
 				So(err, ShouldBeNil)
+				So(got.Enabled, ShouldEqual, tt.args.quota.Enabled)
+				So(got.MaxObjects, ShouldEqual, tt.args.quota.MaxObjects)
+				So(got.MaxSize, ShouldEqual, tt.want)
 				t.Log(got)
 			})
 		}
@@ -96,7 +99,7 @@ func TestRGWClient_PutBucketQuota(t *testing.T) {
 		tests := []struct {
 			name    string
 			args    args
-			want    int
+			want    int64
 			wantErr bool
 		}{
 			{"PutBucketQuota should success", args{"quota-user", "test-bkt", Quota{
@@ -104,25 +107,103 @@ func TestRGWClient_PutBucketQuota(t *testing.T) {
 				CheckOnRaw: false,
 				MaxSizeKB:  200,
 				MaxObjects: 100,
-			}}, 200, false},
+			}}, 200 * 1024, false},
 		}
 
 		for _, tt := range tests {
 			Convey(tt.name, func() {
-				var buf bytes.Buffer
-				err := json.NewEncoder(&buf).Encode(tt.args.quota)
+				err := rgw.PutBucketQuota(tt.args.uid, tt.args.bucket, &tt.args.quota)
 				So(err, ShouldBeNil)
 
-				got, err := rgw.PutBucketQuota(tt.args.uid, tt.args.bucket, bytes.NewReader(buf.Bytes()))
-				So(got, ShouldNotBeNil)
-				So(got.StatusCode, ShouldEqual, tt.want)
+				got, err := rgw.GetBucketQuota(tt.args.bucket)
 				So(err, ShouldBeNil)
+				So(got.Enabled, ShouldEqual, tt.args.quota.Enabled)
+				So(got.MaxObjects, ShouldEqual, tt.args.quota.MaxObjects)
+				So(got.MaxSize, ShouldEqual, tt.want)
 				t.Log(got)
 			})
 		}
 	})
 }
 
+func TestQuota_Validate(t *testing.T) {
+	Convey("TestQuota_Validate", t, func() {
+		tests := []struct {
+			name           string
+			quota          Quota
+			wantErr        bool
+			wantMaxSize    int64
+			wantMaxSizeKB  int64
+			wantMaxObjects int64
+		}{
+			{"unlimited quota should be valid", Quota{MaxSize: Unlimited, MaxObjects: Unlimited}, false, Unlimited, Unlimited, Unlimited},
+			{"zero limits should be kept", Quota{Enabled: true}, false, 0, 0, 0},
+			{"unlimited kb should be unlimited size", Quota{MaxSizeKB: Unlimited, MaxObjects: 10}, false, Unlimited, Unlimited, 10},
+			{"max size should be derived from kb", Quota{MaxSizeKB: 100}, false, 100 * 1024, 100, 0},
+			{"kb should be rounded up from max size", Quota{MaxSize: 1000}, false, 1000, 1, 0},
+			{"agreed max size and kb should be valid", Quota{MaxSize: 2048, MaxSizeKB: 2}, false, 2048, 2, 0},
+			{"conflicting max size and kb should be invalid", Quota{MaxSize: 2048, MaxSizeKB: 3}, true, 0, 0, 0},
+			{"unlimited max size with kb should be invalid", Quota{MaxSize: Unlimited, MaxSizeKB: 3}, true, 0, 0, 0},
+			{"max size less than -1 should be invalid", Quota{MaxSize: -2}, true, 0, 0, 0},
+			{"max objects less than -1 should be invalid", Quota{MaxObjects: -5}, true, 0, 0, 0},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				err := tt.quota.Validate()
+				if tt.wantErr {
+					So(errors.Is(err, ErrInvalidQuota), ShouldBeTrue)
+					return
+				}
+				So(err, ShouldBeNil)
+				got := tt.quota.normalized()
+				So(got.MaxSize, ShouldEqual, tt.wantMaxSize)
+				So(got.MaxSizeKB, ShouldEqual, tt.wantMaxSizeKB)
+				So(got.MaxObjects, ShouldEqual, tt.wantMaxObjects)
+			})
+		}
+	})
+}
+
+func TestRGWClient_putQuota(t *testing.T) {
+	Convey("TestRGWClient_putQuota", t, func() {
+		Convey("invalid quota should not be sent", func() {
+			rgw, received := buildReplayRGWClient(t, []int{200}, []string{""})
+			err := rgw.PutUserQuota("quota-user", &Quota{MaxSize: -2})
+			So(errors.Is(err, ErrInvalidQuota), ShouldBeTrue)
+			So(*received, ShouldBeEmpty)
+		})
+
+		Convey("normalized quota should be sent", func() {
+			rgw, received := buildReplayRGWClient(t, []int{200}, []string{""})
+			err := rgw.PutBucketQuota("quota-user", "test-bkt", &Quota{Enabled: true, MaxSizeKB: 10})
+			So(err, ShouldBeNil)
+			So(*received, ShouldHaveLength, 1)
+			var sent Quota
+			So(json.Unmarshal([]byte((*received)[0]), &sent), ShouldBeNil)
+			So(sent.MaxSize, ShouldEqual, 10*1024)
+		})
+
+		Convey("zero limits should be sent as 0", func() {
+			rgw, received := buildReplayRGWClient(t, []int{404}, []string{`{"Code":"NoSuchUser"}`})
+			err := rgw.PutUserBucketQuota("nobody", &Quota{Enabled: true})
+			So(IsNoSuchUser(err), ShouldBeTrue)
+			So(*received, ShouldHaveLength, 1)
+			So((*received)[0], ShouldEqual, `{"enabled":true,"check_on_raw":false,"max_size":0,"max_size_kb":0,"max_objects":0}`)
+		})
+
+		Convey("unlimited quota should be sent as unlimited", func() {
+			rgw, received := buildReplayRGWClient(t, []int{200}, []string{""})
+			err := rgw.PutUserQuota("quota-user", &Quota{MaxSize: Unlimited, MaxObjects: Unlimited})
+			So(err, ShouldBeNil)
+			So(*received, ShouldHaveLength, 1)
+			var sent Quota
+			So(json.Unmarshal([]byte((*received)[0]), &sent), ShouldBeNil)
+			So(sent, ShouldResemble, Quota{MaxSize: Unlimited, MaxSizeKB: Unlimited, MaxObjects: Unlimited})
+		})
+	})
+}
+
 func TestRGWClient_GetUserQuota(t *testing.T) {
 	rgw := buildRGWClient(t)
 
@@ -179,6 +260,51 @@ func TestRGWClient_GetUserBucketQuota(t *testing.T) {
 	})
 }
 
+func TestRGWClient_GetBucketQuota(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_GetBucketQuota", t, func() {
+		type args struct {
+			bucket string
+		}
+		tests := []struct {
+			name    string
+			args    args
+			want    int64
+			wantErr bool
+		}{
+			{"GetBucketQuota should success", args{"test-bkt"}, 100, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.GetBucketQuota(tt.args.bucket)
+				So(got, ShouldNotBeNil)
+				So(got.MaxObjects, ShouldEqual, tt.want)
+				So(err, ShouldBeNil)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_getBucketQuota(t *testing.T) {
+	Convey("TestRGWClient_getBucketQuota", t, func() {
+		var rawQuery string
+		rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rawQuery = req.URL.RawQuery
+			io.WriteString(w, `{"bucket":"bkt","bucket_quota":{"enabled":true,"max_size":-1,"max_size_kb":0,"max_objects":100}}`)
+		}))
+
+		Convey("bucket name should be escaped", func() {
+			got, err := rgw.GetBucketQuota("bkt&uid=other")
+			So(err, ShouldBeNil)
+			So(rawQuery, ShouldEqual, "bucket=bkt%26uid%3Dother")
+			So(got, ShouldResemble, &Quota{Enabled: true, MaxSize: Unlimited, MaxObjects: 100})
+		})
+	})
+}
+
 func TestRGWClient_GetBucketInfo(t *testing.T) {
 	rgw := buildRGWClient(t)
 
@@ -415,6 +541,153 @@ func TestRGWClient_RemoveKey(t *testing.T) {
 	})
 }
 
+func TestRGWClient_CreateSubuser(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_CreateSubuser", t, func() {
+		type args struct {
+			subuserConf SubuserConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			want    Subuser
+			wantErr bool
+		}{
+			{"CreateSubuser should success", args{SubuserConf{
+				Uid:            "new-user",
+				Subuser:        "new-user:swift",
+				KeyType:        KeyTypeSwift,
+				Access:         SubuserAccessReadWrite,
+				GenerateSecret: true,
+			}}, Subuser{ID: "new-user:swift", Permissions: "read-write"}, false},
+			{"CreateSubuser with invalid access should fail", args{SubuserConf{
+				Uid:     "new-user",
+				Subuser: "new-user:bad",
+				Access:  "all",
+			}}, Subuser{}, true},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.CreateSubuser(&tt.args.subuserConf)
+				if tt.wantErr {
+					So(err, ShouldNotBeNil)
+					return
+				}
+				So(err, ShouldBeNil)
+				So(got, ShouldContain, tt.want)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_ModifySubuser(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_ModifySubuser", t, func() {
+		type args struct {
+			subuserConf SubuserConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			want    Subuser
+			wantErr bool
+		}{
+			{"ModifySubuser should success", args{SubuserConf{
+				Uid:     "new-user",
+				Subuser: "new-user:swift",
+				Access:  SubuserAccessFull,
+			}}, Subuser{ID: "new-user:swift", Permissions: "full-control"}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.ModifySubuser(&tt.args.subuserConf)
+				So(err, ShouldBeNil)
+				So(got, ShouldContain, tt.want)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_RemoveSubuser(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_RemoveSubuser", t, func() {
+		type args struct {
+			subuserConf SubuserConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"RemoveSubuser should success", args{SubuserConf{
+				Uid:       "new-user",
+				Subuser:   "new-user:swift",
+				PurgeKeys: aws.Bool(true),
+			}}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				err := rgw.RemoveSubuser(&tt.args.subuserConf)
+				So(err != nil, ShouldEqual, tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestRGWClient_subuserRequests(t *testing.T) {
+	Convey("TestRGWClient_subuserRequests", t, func() {
+		var method, rawQuery string
+		rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			method, rawQuery = req.Method, req.URL.RawQuery
+			if req.Method != "DELETE" {
+				io.WriteString(w, `[{"id":"user:swift","permissions":"read-write"}]`)
+			}
+		}))
+		subuserConf := SubuserConf{
+			Uid:            "user",
+			Subuser:        "user:swift",
+			KeyType:        KeyTypeSwift,
+			Access:         SubuserAccessReadWrite,
+			GenerateSecret: true,
+			PurgeKeys:      aws.Bool(false),
+		}
+
+		Convey("CreateSubuser should not send purge-keys", func() {
+			got, err := rgw.CreateSubuser(&subuserConf)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, []Subuser{{ID: "user:swift", Permissions: "read-write"}})
+			So(method, ShouldEqual, "PUT")
+			So(rawQuery, ShouldEqual, "subuser&access=readwrite&generate-secret=true&key-type=swift&subuser=user%3Aswift&uid=user")
+		})
+
+		Convey("ModifySubuser should use POST", func() {
+			_, err := rgw.ModifySubuser(&subuserConf)
+			So(err, ShouldBeNil)
+			So(method, ShouldEqual, "POST")
+		})
+
+		Convey("RemoveSubuser should only send uid, subuser and purge-keys", func() {
+			err := rgw.RemoveSubuser(&subuserConf)
+			So(err, ShouldBeNil)
+			So(method, ShouldEqual, "DELETE")
+			So(rawQuery, ShouldEqual, "subuser&purge-keys=false&subuser=user%3Aswift&uid=user")
+		})
+
+		Convey("subuser should be required", func() {
+			err := rgw.RemoveSubuser(&SubuserConf{Uid: "user"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
 func TestRGWClient_AddCaps(t *testing.T) {
 	rgw := buildRGWClient(t)
 
@@ -0,0 +1,140 @@
+package radosgw
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides how RGWClient resends the requests failed with connection errors,
+// 5xx responses, SlowDown or RequestTimeout
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a request including the first one, 1 or less disables retries
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it is doubled every retry up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomizes the delays, a delay d becomes a random one in [d*(1-Jitter), d]. It should be in [0, 1]
+	Jitter float64
+	// RetryNonIdempotent also retries the requests which may take effect twice or fail after taking effect,
+	// which are CreateUser, ModifyUser with GenerateKey, RemoveUser, CreateKey, RemoveKey, CreateSubuser,
+	// ModifySubuser with GenerateSecret, RemoveSubuser, RemoveBucket, DeleteMetadata and AppendObj
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns the policy of a new RGWClient
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.5,
+	}
+}
+
+// attempts returns the number of attempts of a request
+func (p *RetryPolicy) attempts(idempotent bool) int {
+	if p.MaxAttempts < 1 || (!idempotent && !p.RetryNonIdempotent) {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay returns the delay before the retry-th retry
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay << (retry - 1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// sendReq sends the request with retries by RetryPolicy, it is signed by signReq again before every attempt.
+// body is the body of req, it is rewound to its current position before every retry.
+// No more attempts are made once the context of req is done.
+func (rgw *RGWClient) sendReq(req *http.Request, body io.ReadSeeker, idempotent bool) (*http.Response, error) {
+	var start int64
+	if body != nil {
+		var err error
+		if start, err = body.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	maxAttempts := rgw.RetryPolicy.attempts(idempotent)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && body != nil {
+			if _, err := body.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+			req.Body = io.NopCloser(body)
+		}
+		if err := rgw.signReq(req, body); err != nil {
+			return nil, err
+		}
+
+		resp, err := rgw.httpClient.Do(req)
+		if attempt >= maxAttempts || req.Context().Err() != nil || !shouldRetry(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepCtx(req.Context(), rgw.RetryPolicy.delay(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleepCtx waits for d, it returns the error of ctx if ctx is done earlier
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// shouldRetry tells whether a request failed with a connection error, a 5xx response, SlowDown or RequestTimeout.
+// The body of a 4xx response is read to find the error code, and then replaced by a buffered one.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if resp.StatusCode >= 500 {
+		return true
+	}
+	if resp.StatusCode < 400 {
+		return false
+	}
+
+	buff, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(buff))
+	if err != nil {
+		return true
+	}
+	switch errorCode(buff) {
+	case "SlowDown", "RequestTimeout":
+		return true
+	}
+	return false
+}
+
+// errorCode extracts the code of an XML or JSON error response
+func errorCode(buff []byte) string {
+	return parseErrorResponse(0, buff).Code
+}
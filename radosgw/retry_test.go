@@ -0,0 +1,156 @@
+package radosgw
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildMockRGWClient returns a client with fast retries of a local server served by handler
+func buildMockRGWClient(t *testing.T, handler http.Handler) (*RGWClient, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	conf := &aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("mock-region"),
+		Credentials: credentials.NewStaticCredentials("ak", "sk", ""),
+	}
+	rgw := NewRGWClient(conf, http.DefaultClient)
+	rgw.RetryPolicy.BaseDelay = time.Millisecond
+	rgw.RetryPolicy.MaxDelay = time.Millisecond
+	return rgw, server
+}
+
+// buildReplayRGWClient returns a mock client whose server replies with the responses in order,
+// the last one is repeated. The bodies of the received requests are recorded.
+func buildReplayRGWClient(t *testing.T, statuses []int, bodies []string) (*RGWClient, *[]string) {
+	t.Helper()
+	var received []string
+	rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buff, _ := io.ReadAll(req.Body)
+		received = append(received, string(buff))
+		i := min(len(received), len(statuses)) - 1
+		w.WriteHeader(statuses[i])
+		io.WriteString(w, bodies[i])
+	}))
+	return rgw, &received
+}
+
+func TestRGWClient_sendReq(t *testing.T) {
+	Convey("TestRGWClient_sendReq", t, func() {
+		slowDown := `<Error><Code>SlowDown</Code><Message>slow down</Message></Error>`
+		requestTimeout := `<Error><Code>RequestTimeout</Code><Message>timeout</Message></Error>`
+		noSuchBucket := `<Error><Code>NoSuchBucket</Code><Message>no such bucket</Message></Error>`
+		tests := []struct {
+			name         string
+			statuses     []int
+			bodies       []string
+			idempotent   bool
+			nonIdemRetry bool
+			wantAttempts int
+			wantStatus   int
+		}{
+			{"5xx should be retried", []int{500, 503, 200}, []string{"", slowDown, "ok"}, true, false, 3, 200},
+			{"RequestTimeout should be retried", []int{400, 200}, []string{requestTimeout, "ok"}, true, false, 2, 200},
+			{"other 4xx should not be retried", []int{404}, []string{noSuchBucket}, true, false, 1, 404},
+			{"attempts should be limited", []int{503}, []string{slowDown}, true, false, 3, 503},
+			{"non-idempotent request should not be retried", []int{503, 200}, []string{slowDown, "ok"}, false, false, 1, 503},
+			{"non-idempotent request should be retried if opted in", []int{503, 200}, []string{slowDown, "ok"}, false, true, 2, 200},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				rgw, received := buildReplayRGWClient(t, tt.statuses, tt.bodies)
+				rgw.RetryPolicy.RetryNonIdempotent = tt.nonIdemRetry
+				body := strings.NewReader("payload")
+				req, err := http.NewRequest("PUT", *rgw.config.Endpoint+"/bkt/obj", body)
+				So(err, ShouldBeNil)
+
+				resp, err := rgw.sendReq(req, body, tt.idempotent)
+				So(err, ShouldBeNil)
+				defer resp.Body.Close()
+				So(resp.StatusCode, ShouldEqual, tt.wantStatus)
+				So(*received, ShouldHaveLength, tt.wantAttempts)
+				for _, b := range *received {
+					So(b, ShouldEqual, "payload")
+				}
+				buff, err := io.ReadAll(resp.Body)
+				So(err, ShouldBeNil)
+				So(string(buff), ShouldEqual, tt.bodies[min(tt.wantAttempts, len(tt.bodies))-1])
+			})
+		}
+	})
+}
+
+func TestRetryPolicy_delay(t *testing.T) {
+	Convey("TestRetryPolicy_delay", t, func() {
+		p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+		Convey("delay should be doubled every retry", func() {
+			So(p.delay(1), ShouldEqual, 100*time.Millisecond)
+			So(p.delay(3), ShouldEqual, 400*time.Millisecond)
+		})
+
+		Convey("delay should be capped", func() {
+			So(p.delay(10), ShouldEqual, time.Second)
+			So(p.delay(100), ShouldEqual, time.Second)
+		})
+
+		Convey("jitter should shorten the delay", func() {
+			p.Jitter = 0.5
+			for i := 0; i < 100; i++ {
+				d := p.delay(1)
+				So(d, ShouldBeBetweenOrEqual, 50*time.Millisecond, 100*time.Millisecond)
+			}
+		})
+	})
+}
+
+func TestRGWClient_sendReqWithContext(t *testing.T) {
+	Convey("TestRGWClient_sendReqWithContext", t, func() {
+		tests := []struct {
+			name         string
+			cancelBefore bool
+			timeout      time.Duration
+			wantAttempts int
+			wantErr      error
+		}{
+			{"canceled request should not be sent", true, 0, 0, context.Canceled},
+			{"backoff should be interrupted by the context", false, 50 * time.Millisecond, 1, context.DeadlineExceeded},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				rgw, received := buildReplayRGWClient(t, []int{503}, []string{""})
+				rgw.RetryPolicy.BaseDelay = time.Hour
+				rgw.RetryPolicy.MaxDelay = time.Hour
+				rgw.RetryPolicy.Jitter = 0
+
+				ctx, cancel := context.WithCancel(context.Background())
+				if tt.timeout > 0 {
+					ctx, cancel = context.WithTimeout(context.Background(), tt.timeout)
+				}
+				defer cancel()
+				if tt.cancelBefore {
+					cancel()
+				}
+
+				start := time.Now()
+				_, err := rgw.GetUserInfoWithContext(ctx, "user", "false")
+				So(errors.Is(err, tt.wantErr), ShouldBeTrue)
+				So(*received, ShouldHaveLength, tt.wantAttempts)
+				So(time.Since(start), ShouldBeLessThan, time.Second)
+			})
+		}
+	})
+}
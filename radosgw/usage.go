@@ -0,0 +1,195 @@
+package radosgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-querystring/query"
+)
+
+type UsageConf struct {
+	// Uid selects the usage of a user, or of all the users if it is empty
+	Uid    string `url:"uid,omitempty"`
+	Bucket string `url:"bucket,omitempty"`
+	// Start and End select the usage in [Start, End), they are unbounded if zero.
+	// The usage is logged hourly, so they are rounded down to the hour by RGW. They are sent in UTC.
+	Start time.Time `url:"start,omitempty" layout:"2006-01-02 15:04:05"`
+	End   time.Time `url:"end,omitempty" layout:"2006-01-02 15:04:05"`
+	// ShowEntries and ShowSummary are true if nil, as RGW does by default
+	ShowEntries *bool `url:"show-entries,omitempty"`
+	ShowSummary *bool `url:"show-summary,omitempty"`
+}
+
+type TrimUsageConf struct {
+	// Uid selects the usage of a user, RemoveAll is required to trim the usage of all the users if it is empty
+	Uid    string    `url:"uid,omitempty"`
+	Bucket string    `url:"bucket,omitempty"`
+	Start  time.Time `url:"start,omitempty" layout:"2006-01-02 15:04:05"`
+	End    time.Time `url:"end,omitempty" layout:"2006-01-02 15:04:05"`
+	// RemoveAll confirms trimming the usage of all the users
+	RemoveAll bool `url:"remove-all,omitempty"`
+}
+
+type UsageReport struct {
+	Entries []UsageEntry   `json:"entries"`
+	Summary []UsageSummary `json:"summary"`
+}
+
+// UsageEntry is the usage of a user
+type UsageEntry struct {
+	User    string        `json:"user"`
+	Buckets []UsageBucket `json:"buckets"`
+}
+
+// UsageBucket is the usage of a bucket in the hour starting at Epoch
+type UsageBucket struct {
+	Bucket     string          `json:"bucket"`
+	Time       string          `json:"time"`
+	Epoch      int64           `json:"epoch"`
+	Owner      string          `json:"owner"`
+	Categories []UsageCategory `json:"categories"`
+}
+
+// UsageCategory is the usage of a category of operations, such as get_obj and put_obj
+type UsageCategory struct {
+	Category string `json:"category"`
+	UsageStats
+}
+
+type UsageSummary struct {
+	User       string          `json:"user"`
+	Categories []UsageCategory `json:"categories"`
+	Total      UsageStats      `json:"total"`
+}
+
+type UsageStats struct {
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+	Ops           uint64 `json:"ops"`
+	SuccessfulOps uint64 `json:"successful_ops"`
+}
+
+func (s *UsageStats) add(other *UsageStats) {
+	s.BytesSent += other.BytesSent
+	s.BytesReceived += other.BytesReceived
+	s.Ops += other.Ops
+	s.SuccessfulOps += other.SuccessfulOps
+}
+
+// GetUsage returns the usage log selected by usageConf
+func (rgw *RGWClient) GetUsage(usageConf *UsageConf) (*UsageReport, error) {
+	return rgw.GetUsageWithContext(context.Background(), usageConf)
+}
+
+// GetUsageWithContext is the same as GetUsage with a context to cancel the request
+func (rgw *RGWClient) GetUsageWithContext(ctx context.Context, usageConf *UsageConf) (*UsageReport, error) {
+	conf := *usageConf
+	conf.Start, conf.End = conf.Start.UTC(), conf.End.UTC()
+	v, _ := query.Values(&conf)
+	url := fmt.Sprintf("%s/admin/usage?%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buff, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var report UsageReport
+	err = json.Unmarshal(buff, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, err
+}
+
+// TrimUsage removes the usage log selected by trimConf
+func (rgw *RGWClient) TrimUsage(trimConf *TrimUsageConf) error {
+	return rgw.TrimUsageWithContext(context.Background(), trimConf)
+}
+
+// TrimUsageWithContext is the same as TrimUsage with a context to cancel the request
+func (rgw *RGWClient) TrimUsageWithContext(ctx context.Context, trimConf *TrimUsageConf) error {
+	if trimConf.Uid == "" && !trimConf.RemoveAll {
+		return errors.New("remove-all is required to trim the usage of all users")
+	}
+
+	conf := *trimConf
+	conf.Start, conf.End = conf.Start.UTC(), conf.End.UTC()
+	v, _ := query.Values(&conf)
+	url := fmt.Sprintf("%s/admin/usage?%s", *rgw.config.Endpoint, v.Encode())
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rgw.sendReq(req, nil, true)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readResponse(resp)
+	return err
+}
+
+// ByUser sums up the entries in [start, end) by user, start and end are unbounded if zero
+func (r *UsageReport) ByUser(start, end time.Time) map[string]UsageStats {
+	return r.aggregate(start, end, func(user string, _ *UsageBucket, _ *UsageCategory) string {
+		return user
+	})
+}
+
+// ByBucket sums up the entries in [start, end) by bucket, start and end are unbounded if zero
+func (r *UsageReport) ByBucket(start, end time.Time) map[string]UsageStats {
+	return r.aggregate(start, end, func(_ string, bucket *UsageBucket, _ *UsageCategory) string {
+		return bucket.Bucket
+	})
+}
+
+// ByCategory sums up the entries in [start, end) by category, start and end are unbounded if zero
+func (r *UsageReport) ByCategory(start, end time.Time) map[string]UsageStats {
+	return r.aggregate(start, end, func(_ string, _ *UsageBucket, category *UsageCategory) string {
+		return category.Category
+	})
+}
+
+// aggregate sums up the categories of the entries in [start, end) by the key of them
+func (r *UsageReport) aggregate(start, end time.Time, key func(user string, bucket *UsageBucket, category *UsageCategory) string) map[string]UsageStats {
+	stats := make(map[string]UsageStats)
+	for i := range r.Entries {
+		entry := &r.Entries[i]
+		for j := range entry.Buckets {
+			bucket := &entry.Buckets[j]
+			t := time.Unix(bucket.Epoch, 0)
+			if (!start.IsZero() && t.Before(start)) || (!end.IsZero() && !t.Before(end)) {
+				continue
+			}
+			for k := range bucket.Categories {
+				category := &bucket.Categories[k]
+				name := key(entry.User, bucket, category)
+				s := stats[name]
+				s.add(&category.UsageStats)
+				stats[name] = s
+			}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,150 @@
+package radosgw
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const usageReply = `{
+	"entries": [
+		{"user": "alice", "buckets": [
+			{"bucket": "bkt1", "time": "2024-01-01 10:00:00.000000Z", "epoch": 1704103200, "owner": "alice", "categories": [
+				{"category": "put_obj", "bytes_sent": 0, "bytes_received": 100, "ops": 2, "successful_ops": 2},
+				{"category": "get_obj", "bytes_sent": 50, "bytes_received": 0, "ops": 1, "successful_ops": 1}
+			]},
+			{"bucket": "bkt1", "time": "2024-01-01 11:00:00.000000Z", "epoch": 1704106800, "owner": "alice", "categories": [
+				{"category": "get_obj", "bytes_sent": 30, "bytes_received": 0, "ops": 2, "successful_ops": 1}
+			]}
+		]},
+		{"user": "bob", "buckets": [
+			{"bucket": "bkt2", "time": "2024-01-01 10:00:00.000000Z", "epoch": 1704103200, "owner": "bob", "categories": [
+				{"category": "put_obj", "bytes_sent": 0, "bytes_received": 10, "ops": 1, "successful_ops": 0}
+			]}
+		]}
+	],
+	"summary": [
+		{"user": "alice", "categories": [], "total": {"bytes_sent": 80, "bytes_received": 100, "ops": 5, "successful_ops": 4}},
+		{"user": "bob", "categories": [], "total": {"bytes_sent": 0, "bytes_received": 10, "ops": 1, "successful_ops": 0}}
+	]
+}`
+
+func TestRGWClient_GetUsage(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_GetUsage", t, func() {
+		type args struct {
+			usageConf UsageConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"GetUsage of a user should success", args{UsageConf{Uid: "testid", Start: time.Now().Add(-24 * time.Hour)}}, false},
+			{"GetUsage summary of all users should success", args{UsageConf{ShowEntries: aws.Bool(false)}}, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				got, err := rgw.GetUsage(&tt.args.usageConf)
+				So(err, ShouldBeNil)
+				So(got, ShouldNotBeNil)
+				t.Log(got)
+			})
+		}
+	})
+}
+
+func TestRGWClient_TrimUsage(t *testing.T) {
+	rgw := buildRGWClient(t)
+
+	Convey("TestRGWClient_TrimUsage", t, func() {
+		type args struct {
+			trimConf TrimUsageConf
+		}
+		tests := []struct {
+			name    string
+			args    args
+			wantErr bool
+		}{
+			{"TrimUsage of a user should success", args{TrimUsageConf{Uid: "testid", End: time.Now().Add(-24 * time.Hour)}}, false},
+			{"TrimUsage of all users without remove-all should fail", args{TrimUsageConf{}}, true},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				err := rgw.TrimUsage(&tt.args.trimConf)
+				So(err != nil, ShouldEqual, tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestRGWClient_usageRequests(t *testing.T) {
+	Convey("TestRGWClient_usageRequests", t, func() {
+		var method, rawQuery string
+		rgw, _ := buildMockRGWClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			method, rawQuery = req.Method, req.URL.RawQuery
+			if req.Method == "GET" {
+				io.WriteString(w, usageReply)
+			}
+		}))
+		start := time.Date(2024, 1, 1, 18, 0, 0, 0, time.FixedZone("UTC+8", 8*3600))
+
+		Convey("GetUsage should send the times in UTC", func() {
+			got, err := rgw.GetUsage(&UsageConf{Uid: "alice", Start: start, ShowSummary: aws.Bool(false)})
+			So(err, ShouldBeNil)
+			So(got.Entries, ShouldHaveLength, 2)
+			So(got.Summary[0].Total.Ops, ShouldEqual, 5)
+			So(method, ShouldEqual, "GET")
+			So(rawQuery, ShouldEqual, "show-summary=false&start=2024-01-01+10%3A00%3A00&uid=alice")
+		})
+
+		Convey("TrimUsage should send remove-all", func() {
+			err := rgw.TrimUsage(&TrimUsageConf{RemoveAll: true})
+			So(err, ShouldBeNil)
+			So(method, ShouldEqual, "DELETE")
+			So(rawQuery, ShouldEqual, "remove-all=true")
+		})
+	})
+}
+
+func TestUsageReport_aggregate(t *testing.T) {
+	Convey("TestUsageReport_aggregate", t, func() {
+		var report UsageReport
+		So(json.Unmarshal([]byte(usageReply), &report), ShouldBeNil)
+		tenOClock := time.Unix(1704103200, 0)
+		elevenOClock := time.Unix(1704106800, 0)
+
+		tests := []struct {
+			name      string
+			aggregate func(start, end time.Time) map[string]UsageStats
+			start     time.Time
+			end       time.Time
+			want      map[string]UsageStats
+		}{
+			{"ByUser should sum up all the entries", report.ByUser, time.Time{}, time.Time{}, map[string]UsageStats{
+				"alice": {BytesSent: 80, BytesReceived: 100, Ops: 5, SuccessfulOps: 4},
+				"bob":   {BytesReceived: 10, Ops: 1},
+			}},
+			{"ByBucket should exclude the end", report.ByBucket, tenOClock, elevenOClock, map[string]UsageStats{
+				"bkt1": {BytesSent: 50, BytesReceived: 100, Ops: 3, SuccessfulOps: 3},
+				"bkt2": {BytesReceived: 10, Ops: 1},
+			}},
+			{"ByCategory should include the start", report.ByCategory, elevenOClock, time.Time{}, map[string]UsageStats{
+				"get_obj": {BytesSent: 30, Ops: 2, SuccessfulOps: 1},
+			}},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(tt.aggregate(tt.start, tt.end), ShouldResemble, tt.want)
+			})
+		}
+	})
+}
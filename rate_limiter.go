@@ -0,0 +1,196 @@
+package s3box
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// minAdaptiveRate is the lowest rate RateLimiter.Decrease can reach
+	minAdaptiveRate = 1.0
+	// defaultAdaptiveRate is the rate to slow down from when neither the limit nor the observed rate is known
+	defaultAdaptiveRate = 100.0
+)
+
+// RateLimiter is a token bucket limiter, whose rate can be adjusted in an AIMD way by Decrease and Increase.
+// A zero rate means unlimited. It is safe for concurrent use.
+type RateLimiter struct {
+	mu sync.Mutex
+	// limit is the current rate, max is the configured one
+	limit  float64
+	max    float64
+	tokens float64
+	last   time.Time
+
+	// the rate observed in the last second, used to slow down from when unlimited
+	windowStart time.Time
+	windowCount float64
+	observed    float64
+}
+
+// NewRateLimiter returns a RateLimiter allowing ratePerSecond tokens per second with a burst of one second
+func NewRateLimiter(ratePerSecond float64) *RateLimiter {
+	l := &RateLimiter{
+		limit:  ratePerSecond,
+		max:    ratePerSecond,
+		tokens: ratePerSecond,
+		last:   time.Now(),
+	}
+	return l
+}
+
+// Limit returns the current rate, 0 means unlimited
+func (l *RateLimiter) Limit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Wait blocks until n tokens are available or ctx is done. A request of more tokens than
+// the burst is allowed, and the tokens owed are paid back by the following requests.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.observe(now, float64(n))
+	if l.limit <= 0 {
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+	l.refill(now)
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.limit * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens += float64(n)
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Decrease halves the rate after being throttled, an unlimited limiter slows down from the observed rate
+func (l *RateLimiter) Decrease() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.refill(now)
+	base := l.limit
+	if base <= 0 {
+		base = l.observed
+		if base <= 0 {
+			base = defaultAdaptiveRate
+		}
+		l.tokens = 0
+	}
+	l.limit = base / 2
+	if l.limit < minAdaptiveRate {
+		l.limit = minAdaptiveRate
+	}
+	if l.tokens > l.limit {
+		l.tokens = l.limit
+	}
+}
+
+// Increase raises the rate by 1/rate after a success, about one per second of successes,
+// up to the configured rate if there is one
+func (l *RateLimiter) Increase() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 || l.limit == l.max {
+		return
+	}
+	l.limit += 1 / l.limit
+	if l.max > 0 && l.limit > l.max {
+		l.limit = l.max
+	}
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if l.limit > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.limit
+		if l.tokens > l.limit {
+			l.tokens = l.limit
+		}
+	}
+	l.last = now
+}
+
+func (l *RateLimiter) observe(now time.Time, n float64) {
+	if now.Sub(l.windowStart) >= time.Second {
+		l.observed = l.windowCount / now.Sub(l.windowStart).Seconds()
+		l.windowStart = now
+		l.windowCount = 0
+	}
+	l.windowCount += n
+}
+
+// isThrottlingCode reports whether the error code asks the client to slow down
+func isThrottlingCode(code string) bool {
+	switch code {
+	case "SlowDown", "ServiceUnavailable", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests":
+		return true
+	}
+	return false
+}
+
+// isRetryableCode reports whether a request failed with the error code is worth retrying
+func isRetryableCode(code string) bool {
+	switch code {
+	case "InternalError", "RequestTimeout", "OperationAborted":
+		return true
+	}
+	return isThrottlingCode(code)
+}
+
+// isThrottlingErr reports whether the request is throttled
+func isThrottlingErr(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		if reqErr.StatusCode() == http.StatusServiceUnavailable || reqErr.StatusCode() == http.StatusTooManyRequests {
+			return true
+		}
+	}
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && isThrottlingCode(aerr.Code())
+}
+
+// isRetryableErr reports whether the failed request is worth retrying
+func isRetryableErr(err error) bool {
+	if isThrottlingErr(err) {
+		return true
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && isRetryableCode(aerr.Code())
+}
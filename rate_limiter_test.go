@@ -0,0 +1,95 @@
+package s3box
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	Convey("TestRateLimiter_Wait", t, func() {
+		Convey("requests over the burst should be delayed", func() {
+			l := NewRateLimiter(100)
+			start := time.Now()
+			for i := 0; i < 150; i++ {
+				So(l.Wait(context.Background(), 1), ShouldBeNil)
+			}
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 400*time.Millisecond)
+		})
+
+		Convey("canceled wait should return the error of ctx", func() {
+			l := NewRateLimiter(1)
+			So(l.Wait(context.Background(), 1), ShouldBeNil)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(l.Wait(ctx, 1), ShouldEqual, context.Canceled)
+		})
+
+		Convey("unlimited limiter should never block", func() {
+			var l *RateLimiter
+			So(l.Wait(context.Background(), 1000), ShouldBeNil)
+			So(NewRateLimiter(0).Wait(context.Background(), 1000), ShouldBeNil)
+		})
+	})
+}
+
+func TestRateLimiter_AIMD(t *testing.T) {
+	Convey("TestRateLimiter_AIMD", t, func() {
+		Convey("limited limiter should halve and recover up to its rate", func() {
+			l := NewRateLimiter(100)
+			l.Decrease()
+			So(l.Limit(), ShouldEqual, 50)
+			l.Increase()
+			So(l.Limit(), ShouldAlmostEqual, 50.02, 1e-9)
+			for i := 1; i < 50; i++ {
+				l.Increase()
+			}
+			So(l.Limit(), ShouldAlmostEqual, 51, 0.01)
+			for i := 0; i < 10000; i++ {
+				l.Increase()
+			}
+			So(l.Limit(), ShouldEqual, 100)
+		})
+
+		Convey("unlimited limiter should slow down from a default rate", func() {
+			l := NewRateLimiter(0)
+			l.Decrease()
+			So(l.Limit(), ShouldEqual, defaultAdaptiveRate/2)
+		})
+
+		Convey("rate should not drop below the minimum", func() {
+			l := NewRateLimiter(1)
+			l.Decrease()
+			So(l.Limit(), ShouldEqual, minAdaptiveRate)
+		})
+	})
+}
+
+func TestIsThrottlingErr(t *testing.T) {
+	Convey("TestIsThrottlingErr", t, func() {
+		tests := []struct {
+			name          string
+			err           error
+			wantThrottled bool
+			wantRetryable bool
+		}{
+			{"SlowDown", awserr.New("SlowDown", "Please reduce your request rate.", nil), true, true},
+			{"503", awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 503, "req"), true, true},
+			{"InternalError", awserr.New("InternalError", "", nil), false, true},
+			{"500", awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 500, "req"), false, true},
+			{"RequestTimeTooSkewed", awserr.NewRequestFailure(awserr.New("RequestTimeTooSkewed", "", nil), 403, "req"), false, false},
+			{"AccessDenied", awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, "req"), false, false},
+			{"plain error", errors.New("boom"), false, false},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(isThrottlingErr(tt.err), ShouldEqual, tt.wantThrottled)
+				So(isRetryableErr(tt.err), ShouldEqual, tt.wantRetryable)
+			})
+		}
+	})
+}
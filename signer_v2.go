@@ -69,7 +69,7 @@ func NewSigner(config aws.Config, time time.Time) *Signer {
 }
 
 func (v2 *Signer) Sign(r *http.Request) error {
-	credValue, err := v2.Credentials.Get()
+	credValue, err := v2.Credentials.GetWithContext(r.Context())
 	if err != nil {
 		return err
 	}